@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -17,13 +19,135 @@ import (
 	"daxwalkerfix/internal/idleexit"
 	"daxwalkerfix/internal/output"
 	"daxwalkerfix/internal/proxy"
+	"daxwalkerfix/internal/resolver"
 	"daxwalkerfix/internal/updater"
 )
 
+const maxShownSessions = 5
+
+var limitScopes = map[string]*bandwidth.Limits{
+	"global": &bandwidth.Global,
+	"proxy":  &bandwidth.PerProxy,
+	"conn":   &bandwidth.PerConn,
+}
+
+var limitUsage = map[string]string{
+	"global": "for all traffic",
+	"proxy":  "for each proxy without its own up=/down=",
+	"conn":   "for each client connection",
+}
+
 func main() {
 	timeout := flag.Int("timeout", 360, "Shutdown after N minutes of inactivity")
+	strategy := flag.String("select", "random", "Proxy selection strategy: "+strings.Join(hosts.Strategies, ", "))
+	sticky := flag.String("sticky", "off", "Keep each client on one proxy, keyed by: "+strings.Join(hosts.StickyModes, ", "))
+	stickyTTL := flag.Duration("sticky-ttl", 10*time.Minute, "How long a client keeps its sticky proxy")
+	race := flag.Int("race", 1, "Dial this many proxies at once and keep the first that connects")
+	attempts := flag.Int("attempts", 3, "Connection attempts per client, each on a different proxy")
+	attemptTimeout := flag.Duration("attempt-timeout", 3*time.Second, "Time limit for each connection attempt")
+	backoff := flag.Duration("backoff", 0, "Base delay between attempts, doubled and jittered each retry (0 = none)")
+	domainList := flag.String("domains", hosts.DefaultDomain, "Comma-separated domains to intercept, optionally name=upstream:port")
+	allowSNI := flag.String("allow-sni", "", "Comma-separated extra hostnames (or *.suffix) clients may reach by SNI")
+	rulesFile := flag.String("rules", "", "File of per-domain rules: pattern and proxy, direct, reject or group:<name>")
+	dnsServers := flag.String("dns", strings.Join(resolver.DefaultServers, ","), "Comma-separated DNS servers used to resolve upstreams, bypassing the hosts file")
+	pins := flag.String("pin", "", "Comma-separated name=ip pairs that skip DNS for upstream names")
+	redirectMode := flag.String("redirect", "hosts", "How to send domains to the app: "+strings.Join(hosts.Redirectors, ", "))
+	hostsPath := flag.String("hosts-file", hosts.DefaultHostsPath(), "Hosts file to edit in -redirect hosts mode")
+	dnsListen := flag.String("dns-listen", hosts.DefaultDNSAddr, "Address of the local DNS server in -redirect dns mode")
+	intercept := flag.Bool("intercept", true, "Intercept the domains on 127.0.0.1:443")
+	localAddr := flag.String("proxy-listen", "", "Also serve a local SOCKS5 and HTTP CONNECT proxy on this address, e.g. 127.0.0.1:1080")
+	localAuth := flag.String("proxy-auth", "", "user:pass required by the local proxy")
+	localAllow := flag.String("proxy-allow", "", "Comma-separated destination hosts (or *.suffix) the local proxy may reach")
+	pacAddr := flag.String("pac-listen", "", "Serve a PAC file pointing the domains at the local proxy, e.g. 127.0.0.1:8080")
+	for _, scope := range []string{"global", "proxy", "conn"} {
+		limits := limitScopes[scope]
+		prefix := scope + "-"
+		if scope == "global" {
+			prefix = ""
+		}
+		rateFlag(prefix+"limit-up", "Upload limit "+limitUsage[scope]+", e.g. 512k or 2m", &limits.Upload)
+		rateFlag(prefix+"limit-down", "Download limit "+limitUsage[scope]+", e.g. 512k or 2m", &limits.Download)
+	}
+	maxConns := flag.Int("max-conns", 0, "Most client connections tunnelled at once (0 = no limit)")
+	queueTimeout := flag.Duration("queue-timeout", hosts.DefaultQueueTimeout, "How long a connection waits for a free slot when the limits are reached")
+	warmSize := flag.Int("warm", 0, "Keep this many idle tunnels open per proxy and domain, ready for the next connection")
+	warmIdle := flag.Duration("warm-idle", hosts.DefaultWarmIdle, "Close warm tunnels that have been idle this long")
+	drainTimeout := flag.Duration("drain-timeout", hosts.DefaultDrainTimeout, "On shutdown, wait this long for open connections before closing them")
+	allowNoSNI := flag.Bool("allow-no-sni", false, "Send clients without SNI to the first domain instead of rejecting them")
+	hostsWatch := flag.Duration("hosts-watch", hosts.DefaultWatchInterval, "How often to check that our hosts entries are still there (0 = never)")
+	hostsStrict := flag.Bool("hosts-strict", false, "Stop serving while a removed hosts entry cannot be restored")
+	checkWorkers := flag.Int("check-workers", health.DefaultConcurrency, "How many proxies to health check at once")
+	checkTimeout := flag.Duration("check-timeout", health.DefaultCheckTimeout, "How long a single proxy health check may take")
 	flag.Parse()
 
+	domains, err := hosts.ParseDomains(*domainList)
+	if err != nil {
+		fmt.Printf("FAILED: %v\n", err)
+		os.Exit(1)
+	}
+
+	servers, err := resolver.ParseServers(*dnsServers)
+	if err != nil {
+		fmt.Printf("FAILED: %v\n", err)
+		os.Exit(1)
+	}
+	pinned, err := resolver.ParsePins(*pins)
+	if err != nil {
+		fmt.Printf("FAILED: %v\n", err)
+		os.Exit(1)
+	}
+	upstreamResolver := resolver.New(servers)
+	for name, ips := range pinned {
+		upstreamResolver.Pin(name, ips)
+	}
+
+	redirector, err := hosts.NewRedirector(hosts.RedirectConfig{
+		Mode:      *redirectMode,
+		HostsPath: *hostsPath,
+		DNSAddr:   *dnsListen,
+		Upstream:  upstreamResolver,
+	})
+	if err != nil {
+		fmt.Printf("FAILED: %v\n", err)
+		os.Exit(1)
+	}
+
+	local := hosts.LocalProxy{Addr: *localAddr}
+	if *localAllow != "" {
+		local.Allow = strings.Split(*localAllow, ",")
+	}
+	if *localAuth != "" {
+		user, pass, ok := strings.Cut(*localAuth, ":")
+		if !ok || user == "" {
+			fmt.Println("FAILED: -proxy-auth must be user:pass")
+			os.Exit(1)
+		}
+		local.Auth = url.UserPassword(user, pass)
+	}
+	if *pacAddr != "" && local.Addr == "" {
+		fmt.Println("FAILED: -pac-listen needs -proxy-listen")
+		os.Exit(1)
+	}
+	if !*intercept && local.Addr == "" {
+		fmt.Println("FAILED: -intercept=false needs -proxy-listen")
+		os.Exit(1)
+	}
+
+	var rules []*hosts.Rule
+	if *rulesFile != "" {
+		rules, err = hosts.LoadRules(*rulesFile)
+		if err != nil {
+			fmt.Printf("FAILED: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	selector, err := hosts.NewSelector(*strategy)
+	if err != nil {
+		fmt.Printf("FAILED: %v\n", err)
+		os.Exit(1)
+	}
+
 	output.InitLogger()
 	bandwidth.Init()
 	fmt.Println("Dax Walker Fix by Kolief")
@@ -33,6 +157,20 @@ func main() {
 
 	updater.Check()
 
+	removed, err := hosts.RecoverUncleanShutdown()
+	if err != nil {
+		if *intercept {
+			fmt.Printf("FAILED: %v\n", err)
+			fmt.Println("Press Enter to exit")
+			output.Error("Crash recovery failed: %v", err)
+			fmt.Scanln()
+			os.Exit(1)
+		}
+		output.Warn("Crash recovery skipped: %v", err)
+	} else if removed > 0 {
+		fmt.Printf("Recovered from unclean shutdown: removed %d leftover hosts entries\n", removed)
+	}
+
 	fmt.Println("\nLoading proxies...")
 	output.Info("Loading proxies")
 
@@ -53,13 +191,75 @@ func main() {
 	} else {
 		fmt.Println("├─ Auto-remove failed: No")
 	}
+	fmt.Printf("├─ Proxy selection: %s\n", *strategy)
+	if *sticky != "off" {
+		fmt.Printf("├─ Sticky sessions: by %s, %v\n", *sticky, *stickyTTL)
+	}
+	if *race > 1 {
+		fmt.Printf("├─ Raced dialing: %d proxies\n", *race)
+	}
+	if len(rules) > 0 {
+		fmt.Printf("├─ Routing rules: %d from %s\n", len(rules), *rulesFile)
+	}
+	fmt.Printf("├─ Attempts: %d x %v", *attempts, *attemptTimeout)
+	if *backoff > 0 {
+		fmt.Printf(", backoff %v", *backoff)
+	}
+	fmt.Println()
+	fmt.Printf("├─ Upstream DNS: %s", strings.Join(upstreamResolver.Servers(), ", "))
+	if len(pinned) > 0 {
+		fmt.Printf(" (%d pinned)", len(pinned))
+	}
+	fmt.Println()
+	if *warmSize > 0 {
+		fmt.Printf("├─ Warm tunnels: %d per proxy, max idle %v\n", *warmSize, *warmIdle)
+	}
+	if *maxConns > 0 {
+		fmt.Printf("├─ Connection limit: %d, queue timeout %v\n", *maxConns, *queueTimeout)
+	}
 	fmt.Printf("├─ Idle timeout: %d minutes\n", *timeout)
 	fmt.Println("└─ Log file: daxwalkerfix.log")
 	
 	fmt.Println("\nNetwork Setup:")
-	fmt.Println("├─ Listening on: 127.0.0.1:443")
-	fmt.Println("├─ Hosts file: Modified")
-	fmt.Println("└─ Target domain: walker.dax.cloud → 127.0.0.1")
+	if local.Addr != "" {
+		branch := "├─"
+		if !*intercept {
+			branch = "└─"
+		}
+		fmt.Printf("%s Local proxy: %s (SOCKS5, HTTP CONNECT)", branch, local.Addr)
+		if local.Auth != nil {
+			fmt.Print(", password required")
+		}
+		if len(local.Allow) > 0 {
+			fmt.Printf(", %d allowed hosts", len(local.Allow))
+		}
+		fmt.Println()
+	}
+	if *pacAddr != "" {
+		fmt.Printf("├─ PAC file: http://%s/proxy.pac\n", *pacAddr)
+	}
+	if *intercept {
+		fmt.Println("├─ Listening on: 127.0.0.1:443")
+		switch strings.ToLower(*redirectMode) {
+		case "hosts":
+			fmt.Printf("├─ Hosts file: Modified (%s)\n", *hostsPath)
+		case "dns":
+			fmt.Printf("├─ DNS server: %s (point your DNS here)\n", *dnsListen)
+		default:
+			fmt.Println("├─ Redirect: None, configure clients yourself")
+		}
+		for n, d := range domains {
+			branch := "├─"
+			if n == len(domains)-1 {
+				branch = "└─"
+			}
+			if d.Upstream == "" || d.Upstream == d.Name+":443" {
+				fmt.Printf("%s Target domain: %s → 127.0.0.1\n", branch, d.Name)
+			} else {
+				fmt.Printf("%s Target domain: %s → 127.0.0.1 (upstream %s)\n", branch, d.Name, d.Upstream)
+			}
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -67,6 +267,7 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
+		defer output.Recover("signal handler")
 		<-sigChan
 		fmt.Println("\nShutting down...")
 		bandwidth.LogSession()
@@ -77,6 +278,33 @@ func main() {
 	idleexit.Start(ctx, time.Duration(*timeout)*time.Minute, cancel)
 
 	interceptor := hosts.New(proxies, false)
+	interceptor.SetSelector(selector)
+	interceptor.SetDomains(domains)
+	interceptor.SetSNIPolicy(strings.Split(*allowSNI, ","), *allowNoSNI)
+	interceptor.SetResolver(upstreamResolver)
+	interceptor.SetRedirector(redirector)
+	interceptor.SetIntercept(*intercept)
+	interceptor.SetLocalProxy(local)
+	interceptor.SetPAC(*pacAddr)
+	interceptor.SetRules(rules)
+	interceptor.SetConnLimit(*maxConns, *queueTimeout)
+	interceptor.SetWarmPool(*warmSize, *warmIdle)
+	interceptor.SetDrainTimeout(*drainTimeout)
+	interceptor.SetHostsWatch(*hostsWatch, *hostsStrict)
+	interceptor.SetRace(*race)
+	err = interceptor.SetRetryPolicy(hosts.RetryPolicy{
+		Attempts: *attempts,
+		Timeout:  *attemptTimeout,
+		Backoff:  *backoff,
+	})
+	if err != nil {
+		fmt.Printf("FAILED: %v\n", err)
+		os.Exit(1)
+	}
+	if err := interceptor.SetSticky(*sticky, *stickyTTL); err != nil {
+		fmt.Printf("FAILED: %v\n", err)
+		os.Exit(1)
+	}
 	
 	var workingProxies = len(proxies)
 	var failedProxies = 0
@@ -88,7 +316,53 @@ func main() {
 		fmt.Println()
 		fmt.Printf("Status: Running | Active: %d | Total: %d | Time: %s\n", 
 			interceptor.GetConnCount(), interceptor.GetTotalConns(), time.Now().Format("15:04:05"))
-		fmt.Printf("Proxies: %d working, %d failed\n", workingProxies, failedProxies)
+		for _, err := range interceptor.SetupProblems() {
+			fmt.Printf("WARNING: %v\n", err)
+		}
+		if w := interceptor.HostsWatch(); w.Paused {
+			fmt.Printf("WARNING: hosts entry for %s removed and could not be restored, serving paused\n", strings.Join(w.Missing, ", "))
+		} else if len(w.Missing) > 0 {
+			fmt.Printf("WARNING: hosts entry for %s removed and could not be restored, traffic may go direct\n", strings.Join(w.Missing, ", "))
+		} else if w.Tampered > 0 {
+			fmt.Printf("WARNING: hosts entry was removed %d times and restored, last at %s\n", w.Tampered, w.LastTamper.Format("15:04:05"))
+		}
+		open := interceptor.OpenCircuits()
+		if open > 0 {
+			fmt.Printf("Proxies: %d working, %d failed (%d circuit open)\n", workingProxies-open, failedProxies+open, open)
+		} else {
+			fmt.Printf("Proxies: %d working, %d failed\n", workingProxies, failedProxies)
+		}
+		if sessions := interceptor.Sessions(); len(sessions) > 0 {
+			fmt.Printf("Sticky sessions: %d\n", len(sessions))
+			for n, s := range sessions {
+				if n == maxShownSessions {
+					fmt.Printf("  ...and %d more\n", len(sessions)-maxShownSessions)
+					break
+				}
+				fmt.Printf("  %s → %s (%v left)\n", s.Key, s.Proxy.Label(), time.Until(s.Expires).Round(time.Second))
+			}
+		}
+		if hits := interceptor.RuleHits(); len(hits) > 0 {
+			var parts []string
+			for _, h := range hits {
+				parts = append(parts, fmt.Sprintf("%s: %d", h.Rule, h.Hits))
+			}
+			fmt.Printf("Rule hits: %s\n", strings.Join(parts, ", "))
+		}
+		if checked, total := health.Progress(); total > 0 {
+			fmt.Printf("Health check: %d/%d proxies checked\n", checked, total)
+		}
+		if *warmSize > 0 {
+			fmt.Printf("Warm tunnels: %d ready\n", interceptor.WarmTunnels())
+		}
+		if q := interceptor.QueueStats(); q.Depth > 0 || q.Waited > 0 {
+			fmt.Printf("Queue: %d waiting | %d queued so far, avg wait %v, max %v\n",
+				q.Depth, q.Waited, q.AvgWait.Round(time.Millisecond), q.MaxWait.Round(time.Millisecond))
+		}
+		if bandwidth.Global.Active() || bandwidth.PerProxy.Active() || bandwidth.PerConn.Active() {
+			fmt.Printf("Limits: global %s | per proxy %s | per connection %s\n",
+				bandwidth.Global.String(), bandwidth.PerProxy.String(), bandwidth.PerConn.String())
+		}
 		
 		in, out, duration := bandwidth.GetStats()
 		total := in + out
@@ -97,6 +371,7 @@ func main() {
 			duration.Round(time.Second))
 		
 		fmt.Println(strings.Repeat("━", 60))
+		fmt.Println("Type \"limit global|proxy|conn up|down 2m\" to change limits")
 		fmt.Println("Press Ctrl+C to stop")
 		fmt.Println()
 	}
@@ -106,45 +381,41 @@ func main() {
 		failedProxies += failed
 		printHeader()
 	}
-	go health.CheckProxies(ctx, proxies, file.GetLastLoadedPath(), autoRemove, interceptor.UpdateProxies, updateProxyCount)
+	checkOptions := health.Options{Concurrency: *checkWorkers, Timeout: *checkTimeout, Resolver: upstreamResolver}
+	go health.CheckProxies(ctx, proxies, file.GetLastLoadedPath(), autoRemove, checkOptions, interceptor.UpdateProxies, updateProxyCount)
 
+	stopped := make(chan struct{})
+	failed := make(chan error, 1)
 	go func() {
-		err := interceptor.Start(ctx)
-		if err != nil {
-			fmt.Printf("FAILED: %v\n", err)
-			fmt.Println("Try running as Administrator")
-			fmt.Println("Press Enter to exit")
-			output.Error("Failed to start: %v", err)
-			fmt.Scanln()
-			os.Exit(1)
+		defer close(stopped)
+		defer output.Recover("interceptor")
+		if err := interceptor.Start(ctx); err != nil {
+			failed <- err
 		}
 	}()
 
 	time.Sleep(500 * time.Millisecond)
-	socksCount := 0
-	httpsCount := 0
+	typeCounts := make(map[proxy.ProxyType]int)
+	var types []proxy.ProxyType
 	for _, p := range proxies {
-		if p.Type == proxy.SOCKS5 {
-			socksCount++
-		} else if p.Type == proxy.HTTPS {
-			httpsCount++
+		if typeCounts[p.Type] == 0 {
+			types = append(types, p.Type)
 		}
+		typeCounts[p.Type]++
 	}
-	if socksCount > 0 && httpsCount == 0 {
-		fmt.Printf("Using %d SOCKS5 proxies\n", socksCount)
-	} else if httpsCount > 0 && socksCount == 0 {
-		fmt.Printf("Using %d HTTPS proxies\n", httpsCount)
+	if len(types) == 1 {
+		fmt.Printf("Using %d %s proxies\n", len(proxies), types[0])
 	} else {
-		fmt.Printf("Using %d proxies (SOCKS5: %d, HTTPS: %d)\n", len(proxies), socksCount, httpsCount)
+		var parts []string
+		for _, t := range types {
+			parts = append(parts, fmt.Sprintf("%s: %d", t, typeCounts[t]))
+		}
+		fmt.Printf("Using %d proxies (%s)\n", len(proxies), strings.Join(parts, ", "))
 	}
 	
 	fmt.Println("\nProxy Status:")
 	for _, p := range proxies {
-		proxyType := "SOCKS5"
-		if p.Type == proxy.HTTPS {
-			proxyType = "HTTPS"
-		}
-		fmt.Printf("%s (%s) - Ready\n", p.Address, proxyType)
+		fmt.Printf("%s - Ready\n", p.Label())
 	}
 	
 	fmt.Printf("\nWorking: %d/%d proxies", len(proxies), len(proxies))
@@ -154,9 +425,28 @@ func main() {
 		fmt.Print(" | Auto-removal: Disabled")
 	}
 	fmt.Println("\n" + strings.Repeat("━", 70))
-	output.Info("Interceptor running on 127.0.0.1:443 looking for %s", "walker.dax.cloud")
+	var names []string
+	for _, d := range domains {
+		names = append(names, d.Name)
+	}
+	if *intercept {
+		output.Info("Interceptor running on 127.0.0.1:443 looking for %s", strings.Join(names, ", "))
+	}
+	if local.Addr != "" {
+		output.Info("Local proxy running on %s", local.Addr)
+	}
 
 	printHeader()
+
+	commands := make(chan string)
+	go func() {
+		defer close(commands)
+		defer output.Recover("command reader")
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			commands <- scanner.Text()
+		}
+	}()
 	
 	headerTicker := time.NewTicker(5 * time.Second)
 	defer headerTicker.Stop()
@@ -165,9 +455,30 @@ func main() {
 		select {
 		case <-ctx.Done():
 			fmt.Println("\n\nShutting down...")
-			bandwidth.LogSession()
 			output.Info("Shutting down...")
+			<-stopped
+			bandwidth.LogSession()
 			return
+		case err := <-failed:
+			cancel()
+			fmt.Printf("FAILED: %v\n", err)
+			fmt.Println("Try running as Administrator")
+			fmt.Println("Press Enter to exit")
+			output.Error("Failed to start: %v", err)
+			if commands != nil {
+				<-commands
+			}
+			os.Exit(1)
+		case line, ok := <-commands:
+			if !ok {
+				commands = nil
+				continue
+			}
+			if err := runCommand(line); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			printHeader()
 		case <-headerTicker.C:
 			printHeader()
 			output.Info("Status: Active connections: %d, Total: %d", interceptor.GetConnCount(), interceptor.GetTotalConns())
@@ -175,3 +486,42 @@ func main() {
 	}
 }
 
+func rateFlag(name, usage string, limit *bandwidth.Limit) {
+	flag.Func(name, usage, func(value string) error {
+		rate, err := bandwidth.ParseRate(value)
+		if err != nil {
+			return err
+		}
+		limit.Set(rate)
+		return nil
+	})
+}
+
+func runCommand(line string) error {
+	fields := strings.Fields(strings.ToLower(line))
+	if len(fields) == 0 {
+		return nil
+	}
+	if fields[0] != "limit" || len(fields) != 4 {
+		return fmt.Errorf("usage: limit global|proxy|conn up|down <rate>")
+	}
+
+	limits, ok := limitScopes[fields[1]]
+	if !ok {
+		return fmt.Errorf("unknown limit scope %q", fields[1])
+	}
+	rate, err := bandwidth.ParseRate(fields[3])
+	if err != nil {
+		return err
+	}
+	switch fields[2] {
+	case "up":
+		limits.Upload.Set(rate)
+	case "down":
+		limits.Download.Set(rate)
+	default:
+		return fmt.Errorf("expected up or down, got %q", fields[2])
+	}
+	output.Info("Set %s %s limit to %s", fields[1], fields[2], bandwidth.FormatRate(rate))
+	return nil
+}
@@ -0,0 +1,122 @@
+package bandwidth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Limit struct {
+	rate int64
+}
+
+func (l *Limit) Set(bytesPerSec int64) {
+	atomic.StoreInt64(&l.rate, bytesPerSec)
+}
+
+func (l *Limit) Get() int64 {
+	return atomic.LoadInt64(&l.rate)
+}
+
+type Limits struct {
+	Upload   Limit
+	Download Limit
+}
+
+var (
+	Global   Limits
+	PerProxy Limits
+	PerConn  Limits
+
+	globalUpload   = NewLimiter(Global.Upload.Get)
+	globalDownload = NewLimiter(Global.Download.Get)
+)
+
+type Limiter struct {
+	rate   func() int64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate func() int64) *Limiter {
+	return &Limiter{rate: rate}
+}
+
+func (l *Limiter) Wait(n int) {
+	if l == nil {
+		return
+	}
+	rate := l.rate()
+	if rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.last.IsZero() {
+		l.tokens = float64(rate)
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+		if l.tokens > float64(rate) {
+			l.tokens = float64(rate)
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	debt := l.tokens
+	l.mu.Unlock()
+
+	if debt < 0 {
+		time.Sleep(time.Duration(-debt / float64(rate) * float64(time.Second)))
+	}
+}
+
+func ParseRate(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "b")
+	if s == "" || s == "0" || s == "off" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch s[len(s)-1] {
+	case 'k':
+		multiplier = 1024
+	case 'm':
+		multiplier = 1024 * 1024
+	case 'g':
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 512k or 2m", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+func FormatRate(bytesPerSec int64) string {
+	switch {
+	case bytesPerSec <= 0:
+		return "off"
+	case bytesPerSec < 1024*1024:
+		return fmt.Sprintf("%.0f KB/s", float64(bytesPerSec)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB/s", float64(bytesPerSec)/(1024*1024))
+	}
+}
+
+func (l *Limits) String() string {
+	return "↑" + FormatRate(l.Upload.Get()) + " ↓" + FormatRate(l.Download.Get())
+}
+
+func (l *Limits) Active() bool {
+	return l.Upload.Get() > 0 || l.Download.Get() > 0
+}
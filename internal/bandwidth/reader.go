@@ -3,30 +3,38 @@ package bandwidth
 import "io"
 
 type Reader struct {
-	reader io.Reader
+	reader   io.Reader
+	limiters []*Limiter
 }
 
-func WrapReader(r io.Reader) *Reader {
-	return &Reader{reader: r}
+func WrapReader(r io.Reader, limiters ...*Limiter) *Reader {
+	return &Reader{reader: r, limiters: append([]*Limiter{globalUpload}, limiters...)}
 }
 
 func (r *Reader) Read(p []byte) (n int, err error) {
 	n, err = r.reader.Read(p)
 	if n > 0 {
 		AddIn(int64(n))
+		for _, l := range r.limiters {
+			l.Wait(n)
+		}
 	}
 	return n, err
 }
 
 type Writer struct {
-	writer io.Writer
+	writer   io.Writer
+	limiters []*Limiter
 }
 
-func WrapWriter(w io.Writer) *Writer {
-	return &Writer{writer: w}
+func WrapWriter(w io.Writer, limiters ...*Limiter) *Writer {
+	return &Writer{writer: w, limiters: append([]*Limiter{globalDownload}, limiters...)}
 }
 
 func (w *Writer) Write(p []byte) (n int, err error) {
+	for _, l := range w.limiters {
+		l.Wait(len(p))
+	}
 	n, err = w.writer.Write(p)
 	if n > 0 {
 		AddOut(int64(n))
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package file
+
+import "fmt"
+
+func SelectProxyFile() (string, error) {
+	return "", fmt.Errorf("the file selection dialog is only available on Windows")
+}
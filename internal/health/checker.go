@@ -8,16 +8,50 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"daxwalkerfix/internal/hosts"
 	"daxwalkerfix/internal/output"
 	"daxwalkerfix/internal/proxy"
+	"daxwalkerfix/internal/resolver"
 )
 
-func CheckProxies(ctx context.Context, initialProxies []*proxy.Proxy, proxyFile string, autoRemove bool, updateCallback func([]*proxy.Proxy), headerCallback func([]*proxy.Proxy, int)) {
+const (
+	DefaultConcurrency  = 16
+	DefaultCheckTimeout = 3 * time.Second
+)
+
+type Options struct {
+	Concurrency int
+	Timeout     time.Duration
+	Resolver    *resolver.Resolver
+}
+
+var (
+	sweepChecked int64
+	sweepTotal   int64
+)
+
+func Progress() (checked, total int) {
+	return int(atomic.LoadInt64(&sweepChecked)), int(atomic.LoadInt64(&sweepTotal))
+}
+
+func CheckProxies(ctx context.Context, initialProxies []*proxy.Proxy, proxyFile string, autoRemove bool, opts Options, updateCallback func([]*proxy.Proxy), headerCallback func([]*proxy.Proxy, int)) {
+	defer output.Recover("health checker")
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultCheckTimeout
+	}
 	interceptor := hosts.New(nil, false)
+	if opts.Resolver != nil {
+		interceptor.SetResolver(opts.Resolver)
+	}
 	currentProxies := initialProxies
+	removed := make(map[string]*proxy.Proxy)
 
 	fullCheckTicker := time.NewTicker(5 * time.Minute)
 	randomCheckTicker := time.NewTicker(30 * time.Second)
@@ -31,18 +65,26 @@ func CheckProxies(ctx context.Context, initialProxies []*proxy.Proxy, proxyFile
 		case <-ctx.Done():
 			return
 		case <-fullCheckTicker.C:
+			results, err := sweep(ctx, currentProxies, interceptor, opts)
+			if err != nil {
+				output.Info("Health check aborted: %v", err)
+				continue
+			}
 			var working []*proxy.Proxy
 			var failed []*proxy.Proxy
-			for _, p := range currentProxies {
-				if testProxy(p, interceptor) {
+			for n, p := range currentProxies {
+				if results[n] == nil {
 					working = append(working, p)
 				} else {
-					fmt.Printf("[%s] Failed proxy: %s\n", time.Now().Format("15:04:05"), p.Address)
-					output.Info("Removing failed proxy: %s", p.Address)
+					fmt.Printf("[%s] Failed proxy: %s (%v)\n", time.Now().Format("15:04:05"), p.Label(), results[n])
+					output.Info("Removing failed proxy: %s: %v", p.Label(), results[n])
 					failed = append(failed, p)
 				}
 			}
 			if len(working) != len(currentProxies) {
+				for _, p := range failed {
+					removed[p.RedactedURL()] = p
+				}
 				logFailedProxies(failed)
 				if autoRemove {
 					removeProxy(proxyFile, failed)
@@ -54,12 +96,12 @@ func CheckProxies(ctx context.Context, initialProxies []*proxy.Proxy, proxyFile
 		case <-randomCheckTicker.C:
 			if len(currentProxies) > 0 {
 				randomProxy := currentProxies[rand.Intn(len(currentProxies))]
-				if !testProxy(randomProxy, interceptor) {
-					fmt.Printf("\n[%s] Random check failed: %s\n", time.Now().Format("15:04:05"), randomProxy.Address)
+				if err := testProxy(ctx, randomProxy, interceptor, opts.Timeout); err != nil {
+					fmt.Printf("\n[%s] Random check failed: %s (%v)\n", time.Now().Format("15:04:05"), randomProxy.Label(), err)
 				}
 			}
 		case <-retryFailedTicker.C:
-			recovered := retryFailedProxies(interceptor)
+			recovered := retryFailedProxies(ctx, interceptor, opts, removed)
 			if len(recovered) > 0 {
 				currentProxies = append(currentProxies, recovered...)
 				updateCallback(currentProxies)
@@ -69,7 +111,40 @@ func CheckProxies(ctx context.Context, initialProxies []*proxy.Proxy, proxyFile
 	}
 }
 
-func retryFailedProxies(interceptor *hosts.Interceptor) []*proxy.Proxy {
+func sweep(ctx context.Context, proxies []*proxy.Proxy, interceptor *hosts.Interceptor, opts Options) ([]error, error) {
+	atomic.StoreInt64(&sweepChecked, 0)
+	atomic.StoreInt64(&sweepTotal, int64(len(proxies)))
+	defer atomic.StoreInt64(&sweepTotal, 0)
+
+	results := make([]error, len(proxies))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.Concurrency, len(proxies)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer output.Recover("health check worker")
+			for n := range jobs {
+				results[n] = testProxy(ctx, proxies[n], interceptor, opts.Timeout)
+				atomic.AddInt64(&sweepChecked, 1)
+			}
+		}()
+	}
+
+feed:
+	for n := range proxies {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- n:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results, ctx.Err()
+}
+
+func retryFailedProxies(ctx context.Context, interceptor *hosts.Interceptor, opts Options, removed map[string]*proxy.Proxy) []*proxy.Proxy {
 	home, _ := os.UserHomeDir()
 	failedFile := filepath.Join(home, "Desktop", "DaxWalkerFix", "failed_proxies.txt")
 	
@@ -81,6 +156,8 @@ func retryFailedProxies(interceptor *hosts.Interceptor) []*proxy.Proxy {
 	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
 	var recovered []*proxy.Proxy
 	var stillFailed []string
+	var candidates []*proxy.Proxy
+	rewrite := false
 	
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -88,21 +165,36 @@ func retryFailedProxies(interceptor *hosts.Interceptor) []*proxy.Proxy {
 			continue
 		}
 		
-		p := &proxy.Proxy{
-			Address: line,
-			Type:    proxy.SOCKS5,
+		p, err := proxy.ParseLine(line, proxy.SOCKS5)
+		if err != nil {
+			stillFailed = append(stillFailed, line)
+			continue
 		}
-		
-		if testProxy(p, interceptor) {
+		if known := removed[p.RedactedURL()]; known != nil {
+			p = known
+		}
+		candidates = append(candidates, p)
+		rewrite = rewrite || line != p.RedactedURL()
+	}
+	
+	results, err := sweep(ctx, candidates, interceptor, opts)
+	if err != nil {
+		return nil
+	}
+	for n, p := range candidates {
+		if results[n] == nil {
 			recovered = append(recovered, p)
-			output.Info("Recovered proxy: %s", line)
+			delete(removed, p.RedactedURL())
+			output.Info("Recovered proxy: %s", p.RedactedURL())
 		} else {
-			stillFailed = append(stillFailed, line)
+			stillFailed = append(stillFailed, p.RedactedURL())
 		}
 	}
 	
-	if len(recovered) > 0 {
+	if len(recovered) > 0 || rewrite {
 		updateFailedFile(failedFile, stillFailed)
+	}
+	if len(recovered) > 0 {
 		output.Info("Recovered %d proxies", len(recovered))
 	}
 	
@@ -138,7 +230,7 @@ func logFailedProxies(failed []*proxy.Proxy) {
 	defer file.Close()
 	
 	for _, p := range failed {
-		file.WriteString(p.Address + "\n")
+		file.WriteString(p.RedactedURL() + "\n")
 	}
 }
 
@@ -167,13 +259,8 @@ func removeProxy(filePath string, failed []*proxy.Proxy) {
 			continue
 		}
 		
-		parts := strings.Split(line, ":")
-		if len(parts) >= 2 {
-			address := parts[0] + ":" + parts[1]
-			if !failedAddresses[address] {
-				lines = append(lines, scanner.Text())
-			}
-		} else {
+		p, err := proxy.ParseLine(line, proxy.SOCKS5)
+		if err != nil || !failedAddresses[p.Address] {
 			lines = append(lines, scanner.Text())
 		}
 	}
@@ -189,13 +276,15 @@ func removeProxy(filePath string, failed []*proxy.Proxy) {
 	}
 }
 
-func testProxy(p *proxy.Proxy, interceptor *hosts.Interceptor) bool {
-	conn, err := interceptor.TestProxy("httpbin.org:80", p)
+func testProxy(ctx context.Context, p *proxy.Proxy, interceptor *hosts.Interceptor, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := interceptor.TestProxy(ctx, "httpbin.org:80", p)
 	if err != nil {
-		return false
+		return err
 	}
 	if conn != nil {
 		conn.Close()
 	}
-	return true
+	return nil
 }
@@ -0,0 +1,100 @@
+package hosts
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	breakerThreshold = 3
+	breakerCooldown  = 30 * time.Second
+)
+
+var errNoProxyAvailable = errors.New("no proxy available, all circuits are open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func (b *breaker) available() bool {
+	switch b.state {
+	case BreakerOpen:
+		return time.Since(b.openedAt) >= breakerCooldown
+	case BreakerHalfOpen:
+		return !b.probing
+	default:
+		return true
+	}
+}
+
+func (b *breaker) claim() bool {
+	if !b.available() {
+		return false
+	}
+	if b.state != BreakerClosed {
+		b.state = BreakerHalfOpen
+		b.probing = true
+	}
+	return true
+}
+
+func (b *breaker) release() {
+	b.probing = false
+}
+
+func (b *breaker) success() bool {
+	recovered := b.state != BreakerClosed
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+	return recovered
+}
+
+func (b *breaker) failure() bool {
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= breakerThreshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+func (i *Interceptor) OpenCircuits() int {
+	i.mu.RLock()
+	proxies := i.proxies
+	i.mu.RUnlock()
+
+	open := 0
+	for _, p := range proxies {
+		if i.ProxyStats(p).Breaker != BreakerClosed {
+			open++
+		}
+	}
+	return open
+}
@@ -0,0 +1,48 @@
+package hosts
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"daxwalkerfix/internal/proxy"
+)
+
+type HopError struct {
+	Hop   int
+	Hops  int
+	Proxy *proxy.Proxy
+	Err   error
+}
+
+func (e *HopError) Error() string {
+	if e.Hops == 1 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("hop %d/%d (%s): %v", e.Hop, e.Hops, e.Proxy, e.Err)
+}
+
+func (e *HopError) Unwrap() error {
+	return e.Err
+}
+
+func hopError(hops []*proxy.Proxy, n int, err error) error {
+	return &HopError{Hop: n + 1, Hops: len(hops), Proxy: hops[n], Err: err}
+}
+
+type connDialer struct {
+	conn net.Conn
+}
+
+func (d connDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.conn, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,176 @@
+package hosts
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"daxwalkerfix/internal/output"
+	"daxwalkerfix/internal/resolver"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	DefaultDNSAddr = "127.0.0.1:53"
+	dnsAnswerTTL   = 60
+	dnsReadTimeout = 10 * time.Second
+)
+
+type dnsRedirect struct {
+	addr     string
+	upstream *resolver.Resolver
+	domains  []Domain
+
+	packet   net.PacketConn
+	listener net.Listener
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func (d *dnsRedirect) Apply(domains []Domain) error {
+	d.domains = domains
+
+	packet, err := net.ListenPacket("udp", d.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start DNS server on %s: %v", d.addr, err)
+	}
+	listener, err := net.Listen("tcp", d.addr)
+	if err != nil {
+		packet.Close()
+		return fmt.Errorf("failed to start DNS server on %s: %v", d.addr, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.packet, d.listener, d.cancel = packet, listener, cancel
+	d.wg.Add(2)
+	go d.serveUDP(ctx)
+	go d.serveTCP(ctx)
+	output.Info("DNS server listening on %s", d.addr)
+	return nil
+}
+
+func (d *dnsRedirect) Remove() error {
+	if d.cancel == nil {
+		return nil
+	}
+	d.cancel()
+	d.packet.Close()
+	d.listener.Close()
+	d.wg.Wait()
+	return nil
+}
+
+func (d *dnsRedirect) serveUDP(ctx context.Context) {
+	defer d.wg.Done()
+	defer output.Recover("DNS server")
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := d.packet.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer output.Recover("DNS query")
+			resp, err := d.answer(ctx, "udp", req)
+			if err != nil {
+				output.Info("DNS query from %s failed: %v", addr, err)
+				return
+			}
+			d.packet.WriteTo(resp, addr)
+		}()
+	}
+}
+
+func (d *dnsRedirect) serveTCP(ctx context.Context) {
+	defer d.wg.Done()
+	defer output.Recover("DNS server")
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handleTCP(ctx, conn)
+	}
+}
+
+func (d *dnsRedirect) handleTCP(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	defer output.Recover("DNS query")
+	for {
+		conn.SetReadDeadline(time.Now().Add(dnsReadTimeout))
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+
+		resp, err := d.answer(ctx, "tcp", req)
+		if err != nil {
+			output.Info("DNS query from %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+		if _, err := conn.Write(append(framed, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func (d *dnsRedirect) answer(ctx context.Context, network string, req []byte) ([]byte, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(req); err != nil {
+		return nil, err
+	}
+	if msg.Response {
+		return nil, fmt.Errorf("unexpected DNS response")
+	}
+
+	msg.Response = true
+	msg.RecursionAvailable = true
+	msg.Answers = nil
+	msg.Authorities = nil
+	msg.Additionals = nil
+
+	if len(msg.Questions) != 1 || !d.intercepts(msg.Questions[0].Name.String()) {
+		resp, err := d.upstream.Exchange(ctx, network, req)
+		if err == nil {
+			return resp, nil
+		}
+		output.Info("DNS forward failed: %v", err)
+		msg.RCode = dnsmessage.RCodeServerFailure
+		return msg.Pack()
+	}
+
+	q := msg.Questions[0]
+	msg.Authoritative = true
+	msg.RCode = dnsmessage.RCodeSuccess
+	if q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL {
+		var ip [4]byte
+		host, _, _ := net.SplitHostPort(listenAddr)
+		copy(ip[:], net.ParseIP(host).To4())
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: dnsAnswerTTL},
+			Body:   &dnsmessage.AResource{A: ip},
+		})
+	}
+	return msg.Pack()
+}
+
+func (d *dnsRedirect) intercepts(name string) bool {
+	name = normalizeName(name)
+	for _, domain := range d.domains {
+		if matchPattern(domain.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const DefaultDomain = "walker.dax.cloud"
+
+type Domain struct {
+	Name     string
+	Upstream string
+}
+
+func ParseDomains(list string) ([]Domain, error) {
+	var domains []Domain
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		d, err := ParseDomain(item)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains given")
+	}
+	return domains, nil
+}
+
+func ParseDomain(s string) (Domain, error) {
+	name, upstream, hasUpstream := strings.Cut(s, "=")
+	name = normalizeName(name)
+	if name == "" || strings.ContainsAny(name, " \t/:") || strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+		return Domain{}, fmt.Errorf("invalid domain %q", s)
+	}
+
+	if !hasUpstream {
+		if !strings.HasPrefix(name, "*.") {
+			upstream = net.JoinHostPort(name, "443")
+		}
+		return Domain{Name: name, Upstream: upstream}, nil
+	}
+
+	upstream = strings.TrimSpace(upstream)
+	host, port, err := net.SplitHostPort(upstream)
+	if err != nil {
+		host, port = strings.TrimSuffix(strings.TrimPrefix(upstream, "["), "]"), "443"
+	}
+	if host == "" || port == "" || strings.ContainsAny(upstream, " \t/") {
+		return Domain{}, fmt.Errorf("invalid upstream %q for domain %s", upstream, name)
+	}
+	return Domain{Name: name, Upstream: net.JoinHostPort(host, port)}, nil
+}
+
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+func (i *Interceptor) SetDomains(domains []Domain) error {
+	if len(domains) == 0 {
+		return fmt.Errorf("at least one domain is required")
+	}
+	i.mu.Lock()
+	i.domains = domains
+	i.mu.Unlock()
+	return nil
+}
+
+func (i *Interceptor) Domains() []Domain {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return append([]Domain(nil), i.domains...)
+}
+
+func (i *Interceptor) SetSNIPolicy(allow []string, allowMissing bool) {
+	var patterns []string
+	for _, pattern := range allow {
+		if pattern = normalizeName(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	i.mu.Lock()
+	i.sniAllow = patterns
+	i.sniAllowMissing = allowMissing
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) route(serverName string) (string, error) {
+	i.mu.RLock()
+	domains := i.domains
+	allow := i.sniAllow
+	allowMissing := i.sniAllowMissing
+	i.mu.RUnlock()
+
+	name := normalizeName(serverName)
+	if name == "" {
+		if !allowMissing || domains[0].Upstream == "" {
+			return "", fmt.Errorf("client sent no SNI")
+		}
+		return domains[0].Upstream, nil
+	}
+
+	for _, d := range domains {
+		if d.Name == name {
+			return d.Upstream, nil
+		}
+	}
+	if !validHostname(name) {
+		return "", fmt.Errorf("invalid SNI %q", serverName)
+	}
+	for _, d := range domains {
+		if !strings.HasPrefix(d.Name, "*.") || !matchPattern(d.Name, name) {
+			continue
+		}
+		if d.Upstream == "" {
+			return net.JoinHostPort(name, "443"), nil
+		}
+		return d.Upstream, nil
+	}
+	for _, pattern := range allow {
+		if matchPattern(pattern, name) {
+			return net.JoinHostPort(name, "443"), nil
+		}
+	}
+	return "", fmt.Errorf("SNI %s is not allowed", name)
+}
+
+func matchPattern(pattern, name string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(name, "."+suffix)
+	}
+	return pattern == name
+}
+
+func validHostname(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package hosts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDomain(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Domain
+	}{
+		{"walker.dax.cloud", Domain{Name: "walker.dax.cloud", Upstream: "walker.dax.cloud:443"}},
+		{" Walker.Dax.Cloud. ", Domain{Name: "walker.dax.cloud", Upstream: "walker.dax.cloud:443"}},
+		{"*.dax.cloud", Domain{Name: "*.dax.cloud"}},
+		{"*.dax.cloud=edge.dax.cloud", Domain{Name: "*.dax.cloud", Upstream: "edge.dax.cloud:443"}},
+		{"walker.dax.cloud=10.0.0.1:8443", Domain{Name: "walker.dax.cloud", Upstream: "10.0.0.1:8443"}},
+		{"walker.dax.cloud= 10.0.0.1 ", Domain{Name: "walker.dax.cloud", Upstream: "10.0.0.1:443"}},
+		{"walker.dax.cloud=[2001:db8::1]", Domain{Name: "walker.dax.cloud", Upstream: "[2001:db8::1]:443"}},
+		{"walker.dax.cloud=[2001:db8::1]:8443", Domain{Name: "walker.dax.cloud", Upstream: "[2001:db8::1]:8443"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDomain(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDomainErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"", "invalid domain"},
+		{"=10.0.0.1", "invalid domain"},
+		{"walker.dax.cloud:443", "invalid domain"},
+		{"walker.*.cloud", "invalid domain"},
+		{"walker.dax.cloud=", "invalid upstream"},
+		{"walker.dax.cloud=  ", "invalid upstream"},
+		{"walker.dax.cloud=:443", "invalid upstream"},
+		{"walker.dax.cloud=10.0.0.1:", "invalid upstream"},
+		{"walker.dax.cloud=http://10.0.0.1", "invalid upstream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := ParseDomain(tt.in)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseDomainsRejectsEmptyList(t *testing.T) {
+	if _, err := ParseDomains(" , ,"); err == nil {
+		t.Error("expected an error for an empty list")
+	}
+}
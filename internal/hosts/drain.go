@@ -0,0 +1,74 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"daxwalkerfix/internal/output"
+)
+
+const DefaultDrainTimeout = 10 * time.Second
+
+func (i *Interceptor) SetDrainTimeout(timeout time.Duration) {
+	i.mu.Lock()
+	i.drainTimeout = timeout
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) track(conn net.Conn, client bool) func() {
+	i.liveMu.Lock()
+	i.live[conn] = client
+	i.liveMu.Unlock()
+
+	return func() {
+		i.liveMu.Lock()
+		delete(i.live, conn)
+		i.liveMu.Unlock()
+	}
+}
+
+func (i *Interceptor) closeLive() int {
+	i.liveMu.Lock()
+	defer i.liveMu.Unlock()
+
+	killed := 0
+	for conn, client := range i.live {
+		conn.Close()
+		if client {
+			killed++
+		}
+	}
+	return killed
+}
+
+func (i *Interceptor) drain() {
+	i.mu.RLock()
+	timeout := i.drainTimeout
+	i.mu.RUnlock()
+
+	active := int(i.GetConnCount())
+	if active > 0 {
+		fmt.Printf("Waiting up to %v for %d connections to finish...\n", timeout, active)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		i.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	killed := 0
+	select {
+	case <-done:
+	case <-timer.C:
+		killed = i.closeLive()
+		<-done
+	}
+
+	fmt.Printf("Shutdown: %d connections drained, %d force-closed\n", active-killed, killed)
+	output.Info("Shutdown: %d connections drained, %d force-closed", active-killed, killed)
+}
@@ -0,0 +1,266 @@
+package hosts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	hostsMarker     = "DAX_INTERCEPT"
+	hostsMaxBackups = 5
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+func DefaultHostsPath() string {
+	if runtime.GOOS != "windows" {
+		return "/etc/hosts"
+	}
+	root := os.Getenv("SystemRoot")
+	if root == "" {
+		root = `C:\Windows`
+	}
+	return filepath.Join(root, "System32", "drivers", "etc", "hosts")
+}
+
+type HostsFile struct {
+	Path string
+}
+
+type HostsConflict struct {
+	Line int
+	IP   string
+	Name string
+}
+
+type hostsContent struct {
+	lines    []string
+	eol      string
+	bom      bool
+	trailing bool
+}
+
+func NewHostsFile(path string) *HostsFile {
+	if path == "" {
+		path = DefaultHostsPath()
+	}
+	return &HostsFile{Path: path}
+}
+
+func (h *HostsFile) AddEntries(names []string, ip string) error {
+	content, err := h.read()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, name := range names {
+		if hasHostsEntry(content.lines, name, ip) {
+			continue
+		}
+		content.lines = append(content.lines, fmt.Sprintf("%s\t%s  # %s", ip, name, hostsMarker))
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return h.write(content)
+}
+
+func (h *HostsFile) RemoveEntries(names []string) (int, error) {
+	content, err := h.read()
+	if err != nil {
+		return 0, err
+	}
+
+	managed := make(map[string]bool)
+	for _, name := range names {
+		managed[name] = true
+	}
+
+	var kept []string
+	for _, line := range content.lines {
+		_, entryNames, comment := parseHostsLine(line)
+		if strings.Contains(comment, hostsMarker) && len(entryNames) > 0 && managed[normalizeName(entryNames[0])] {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	removed := len(content.lines) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	content.lines = kept
+	return removed, h.write(content)
+}
+
+func (h *HostsFile) Conflicts(names []string, ip string) ([]HostsConflict, error) {
+	content, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var conflicts []HostsConflict
+	for n, line := range content.lines {
+		addr, entryNames, comment := parseHostsLine(line)
+		if addr == "" || addr == ip || strings.Contains(comment, hostsMarker) {
+			continue
+		}
+		for _, name := range entryNames {
+			if wanted[normalizeName(name)] {
+				conflicts = append(conflicts, HostsConflict{Line: n + 1, IP: addr, Name: normalizeName(name)})
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+func (h *HostsFile) Missing(names []string, ip string) ([]string, error) {
+	content, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !hasHostsEntry(content.lines, name, ip) {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+func (h *HostsFile) read() (*hostsContent, error) {
+	data, err := os.ReadFile(h.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &hostsContent{eol: "\n"}
+	if rest, ok := bytes.CutPrefix(data, utf8BOM); ok {
+		content.bom = true
+		data = rest
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		content.eol = "\r\n"
+	} else if runtime.GOOS == "windows" && len(data) == 0 {
+		content.eol = "\r\n"
+	}
+
+	text := string(data)
+	content.trailing = text == "" || strings.HasSuffix(text, "\n")
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+	if text != "" {
+		for _, line := range strings.Split(text, "\n") {
+			content.lines = append(content.lines, strings.TrimSuffix(line, "\r"))
+		}
+	}
+	return content, nil
+}
+
+func (h *HostsFile) write(content *hostsContent) error {
+	var buf bytes.Buffer
+	if content.bom {
+		buf.Write(utf8BOM)
+	}
+	buf.WriteString(strings.Join(content.lines, content.eol))
+	if content.trailing && len(content.lines) > 0 {
+		buf.WriteString(content.eol)
+	}
+
+	info, err := os.Stat(h.Path)
+	if err != nil {
+		return err
+	}
+	if err := h.backup(); err != nil {
+		return fmt.Errorf("failed to back up %s: %v", h.Path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(h.Path), "."+filepath.Base(h.Path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), h.Path)
+}
+
+func (h *HostsFile) backup() error {
+	data, err := os.ReadFile(h.Path)
+	if err != nil {
+		return err
+	}
+
+	prefix := h.Path + ".daxwalkerfix-"
+	name := prefix + time.Now().Format("20060102-150405.000000000") + ".bak"
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	backups, _ := filepath.Glob(prefix + "*.bak")
+	sort.Strings(backups)
+	for len(backups) > hostsMaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func hasHostsEntry(lines []string, name, ip string) bool {
+	for _, line := range lines {
+		addr, names, _ := parseHostsLine(line)
+		if addr != ip {
+			continue
+		}
+		for _, n := range names {
+			if normalizeName(n) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseHostsLine(line string) (string, []string, string) {
+	entry, comment, _ := strings.Cut(line, "#")
+	fields := strings.Fields(entry)
+	if len(fields) < 2 {
+		return "", nil, comment
+	}
+	return fields[0], fields[1:], comment
+}
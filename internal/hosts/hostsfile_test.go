@@ -0,0 +1,175 @@
+package hosts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeHostsFile(t *testing.T, content string) *HostsFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewHostsFile(path)
+}
+
+func readHostsFile(t *testing.T, h *HostsFile) string {
+	t.Helper()
+	data, err := os.ReadFile(h.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestHostsFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		added    string
+	}{
+		{
+			name:     "LF",
+			original: "127.0.0.1 localhost\n",
+			added:    "127.0.0.1 localhost\n127.0.0.1\twalker.dax.cloud  # DAX_INTERCEPT\n",
+		},
+		{
+			name:     "CRLF",
+			original: "# comment\r\n127.0.0.1 localhost\r\n",
+			added:    "# comment\r\n127.0.0.1 localhost\r\n127.0.0.1\twalker.dax.cloud  # DAX_INTERCEPT\r\n",
+		},
+		{
+			name:     "BOM and CRLF",
+			original: "\ufeff127.0.0.1 localhost\r\n",
+			added:    "\ufeff127.0.0.1 localhost\r\n127.0.0.1\twalker.dax.cloud  # DAX_INTERCEPT\r\n",
+		},
+		{
+			name:     "no trailing newline",
+			original: "127.0.0.1 localhost",
+			added:    "127.0.0.1 localhost\n127.0.0.1\twalker.dax.cloud  # DAX_INTERCEPT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := writeHostsFile(t, tt.original)
+
+			if err := h.AddEntries([]string{"walker.dax.cloud"}, "127.0.0.1"); err != nil {
+				t.Fatal(err)
+			}
+			if got := readHostsFile(t, h); got != tt.added {
+				t.Errorf("after add got %q, want %q", got, tt.added)
+			}
+
+			removed, err := h.RemoveEntries([]string{"walker.dax.cloud"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != 1 {
+				t.Errorf("removed %d entries, want 1", removed)
+			}
+			if got := readHostsFile(t, h); got != tt.original {
+				t.Errorf("after remove got %q, want %q", got, tt.original)
+			}
+		})
+	}
+}
+
+func TestHostsFileAddIsIdempotent(t *testing.T) {
+	h := writeHostsFile(t, "127.0.0.1 localhost\n")
+	names := []string{"walker.dax.cloud", "api.dax.cloud"}
+
+	for n := 0; n < 2; n++ {
+		if err := h.AddEntries(names, "127.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Count(readHostsFile(t, h), hostsMarker); got != 2 {
+		t.Errorf("got %d managed entries, want 2", got)
+	}
+
+	missing, err := h.Missing(names, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("missing %v after add", missing)
+	}
+}
+
+func TestHostsFileRemoveKeepsUnmanagedLines(t *testing.T) {
+	original := "127.0.0.1 walker.dax.cloud\n127.0.0.1\tother.example  # DAX_INTERCEPT\n"
+	h := writeHostsFile(t, original)
+
+	removed, err := h.RemoveEntries([]string{"walker.dax.cloud"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Errorf("removed %d entries, want 0", removed)
+	}
+	if got := readHostsFile(t, h); got != original {
+		t.Errorf("got %q, want %q", got, original)
+	}
+}
+
+func TestHostsFileConflicts(t *testing.T) {
+	h := writeHostsFile(t, strings.Join([]string{
+		"127.0.0.1 localhost",
+		"203.0.113.5 Walker.Dax.Cloud. # pinned by someone",
+		"127.0.0.1 walker.dax.cloud",
+		"10.0.0.1 unrelated.example",
+		"127.0.0.1\twalker.dax.cloud  # DAX_INTERCEPT",
+	}, "\n"))
+
+	conflicts, err := h.Conflicts([]string{"walker.dax.cloud"}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := HostsConflict{Line: 2, IP: "203.0.113.5", Name: "walker.dax.cloud"}
+	if len(conflicts) != 1 || conflicts[0] != want {
+		t.Errorf("got %+v, want [%+v]", conflicts, want)
+	}
+}
+
+func TestHostsFileBackups(t *testing.T) {
+	h := writeHostsFile(t, "127.0.0.1 localhost\n")
+
+	if err := h.AddEntries([]string{"walker.dax.cloud"}, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.RemoveEntries([]string{"walker.dax.cloud"}); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := filepath.Glob(h.Path + ".daxwalkerfix-*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got %d backups, want 2", len(backups))
+	}
+	first, err := os.ReadFile(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != "127.0.0.1 localhost\n" {
+		t.Errorf("oldest backup is %q, want the original file", first)
+	}
+
+	for n := 0; n < hostsMaxBackups+2; n++ {
+		if err := h.AddEntries([]string{"walker.dax.cloud"}, "127.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.RemoveEntries([]string{"walker.dax.cloud"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ = filepath.Glob(h.Path + ".daxwalkerfix-*.bak")
+	if len(backups) != hostsMaxBackups {
+		t.Errorf("got %d backups, want %d", len(backups), hostsMaxBackups)
+	}
+}
@@ -4,11 +4,10 @@ import (
 	"bufio"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
-	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -18,29 +17,79 @@ import (
 	"daxwalkerfix/internal/idleexit"
 	"daxwalkerfix/internal/output"
 	"daxwalkerfix/internal/proxy"
+	"daxwalkerfix/internal/resolver"
 
 	socks "golang.org/x/net/proxy"
 )
 
-const (
-	domain    = "walker.dax.cloud"
-	hostsFile = `C:\Windows\System32\drivers\etc\hosts`
-	hostsLine = "127.0.0.1	walker.dax.cloud  # DAX_INTERCEPT"
-)
+const listenAddr = "127.0.0.1:443"
+
+var errSelfDial = errors.New("upstream resolves to our own listener")
 
 type Interceptor struct {
-	proxies     []*proxy.Proxy
-	debug       bool
-	wg          sync.WaitGroup
-	mu          sync.RWMutex
-	connCount   int64
-	totalConns  int64
+	proxies    []*proxy.Proxy
+	domains    []Domain
+	sniAllow   []string
+	rules      []*Rule
+	selector   Selector
+	resolver   *resolver.Resolver
+	redirect   Redirector
+	intercept  bool
+	localProxy LocalProxy
+	pacAddr    string
+	listening  []net.Addr
+	debug      bool
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
+	connCount  int64
+	totalConns int64
+	race       int
+	retry      RetryPolicy
+
+	maxConns     int
+	queueTimeout time.Duration
+	openConns    int64
+	queue        slotQueue
+	warm         warmPool
+	drainTimeout time.Duration
+
+	liveMu sync.Mutex
+	live   map[net.Conn]bool
+
+	watch         hostsWatch
+	setupProblems []error
+	setupRecheck  chan struct{}
+
+	sniAllowMissing bool
+
+	statsMu sync.Mutex
+	stats   map[*proxy.Proxy]*proxyStats
+
+	sessionMu  sync.Mutex
+	stickyMode string
+	stickyTTL  time.Duration
+	sessions   map[string]*session
 }
 
 func New(proxies []*proxy.Proxy, debug bool) *Interceptor {
 	return &Interceptor{
-		proxies: proxies,
-		debug:   debug,
+		proxies:   proxies,
+		domains:   []Domain{{Name: DefaultDomain, Upstream: DefaultDomain + ":443"}},
+		selector:  RandomSelector{},
+		resolver:  resolver.New(nil),
+		redirect:  &hostsRedirect{file: NewHostsFile("")},
+		intercept: true,
+		retry:     DefaultRetryPolicy(),
+
+		queueTimeout: DefaultQueueTimeout,
+		drainTimeout: DefaultDrainTimeout,
+		live:         make(map[net.Conn]bool),
+		setupRecheck: make(chan struct{}, 1),
+		debug:        debug,
+		stats:        make(map[*proxy.Proxy]*proxyStats),
+
+		stickyMode: "off",
+		sessions:   make(map[string]*session),
 	}
 }
 
@@ -48,10 +97,62 @@ func (i *Interceptor) UpdateProxies(proxies []*proxy.Proxy) {
 	i.mu.Lock()
 	i.proxies = proxies
 	i.mu.Unlock()
+
+	current := make(map[*proxy.Proxy]bool)
+	for _, p := range proxies {
+		current[p] = true
+	}
+	i.statsMu.Lock()
+	for p, s := range i.stats {
+		if !current[p] && s.retire() {
+			delete(i.stats, p)
+		}
+	}
+	i.statsMu.Unlock()
+}
+
+func (i *Interceptor) SetSelector(selector Selector) {
+	i.mu.Lock()
+	i.selector = selector
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) SetResolver(r *resolver.Resolver) {
+	i.mu.Lock()
+	i.resolver = r
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) SetRedirector(r Redirector) {
+	i.mu.Lock()
+	i.redirect = r
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) SetRace(n int) {
+	i.mu.Lock()
+	i.race = n
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) SetRetryPolicy(policy RetryPolicy) error {
+	if policy.Attempts < 1 || policy.Attempts > MaxAttempts {
+		return fmt.Errorf("attempts must be between 1 and %d", MaxAttempts)
+	}
+	if policy.Timeout <= 0 {
+		return fmt.Errorf("attempt timeout must be positive")
+	}
+	if policy.Backoff < 0 || policy.Backoff > MaxBackoff {
+		return fmt.Errorf("backoff must be between 0 and %v", MaxBackoff)
+	}
+	i.mu.Lock()
+	i.retry = policy
+	i.mu.Unlock()
+	return nil
 }
 
-func (i *Interceptor) TestProxy(addr string, p *proxy.Proxy) (net.Conn, error) {
-	return i.connectTo(addr, p)
+func (i *Interceptor) TestProxy(ctx context.Context, addr string, p *proxy.Proxy) (net.Conn, error) {
+	return i.connectTo(ctx, addr, p)
 }
 
 func (i *Interceptor) GetConnCount() int64 {
@@ -63,64 +164,200 @@ func (i *Interceptor) GetTotalConns() int64 {
 }
 
 func (i *Interceptor) Start(ctx context.Context) error {
-	if err := i.addHostsEntry(); err != nil {
-		return fmt.Errorf("failed to modify hosts file: %v", err)
+	i.mu.RLock()
+	redirect := i.redirect
+	intercept := i.intercept
+	local := i.localProxy
+	pacAddr := i.pacAddr
+	i.mu.RUnlock()
+
+	if !intercept && local.Addr == "" {
+		return fmt.Errorf("interception and the local proxy are both disabled")
 	}
-	defer i.removeHostsEntry()
 
-	listener, err := net.Listen("tcp", "127.0.0.1:443")
-	if err != nil {
-		return fmt.Errorf("failed to listen on port 443: %v", err)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer i.setListening(nil)
+
+	var listeners []net.Listener
+	var accepting sync.WaitGroup
+
+	if intercept {
+		if err := redirect.Apply(i.Domains()); err != nil {
+			return err
+		}
+		defer redirect.Remove()
+
+		listener, err := net.Listen("tcp", listenAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on port 443: %v", err)
+		}
+		defer listener.Close()
+		listeners = append(listeners, listener)
+		i.addListening(listener.Addr())
+		accepting.Add(1)
+		go i.serve(ctx, listener, i.handleConnection, &accepting)
+		go i.verifySetup(ctx, redirect)
 	}
-	defer listener.Close()
 
-	go func() {
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				return
-			}
-			i.wg.Add(1)
-			go i.handleConnection(conn)
+	if local.Addr != "" {
+		listener, err := net.Listen("tcp", local.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to start local proxy on %s: %v", local.Addr, err)
 		}
-	}()
+		defer listener.Close()
+		listeners = append(listeners, listener)
+		i.addListening(listener.Addr())
+		accepting.Add(1)
+		go i.serve(ctx, listener, i.handleLocalProxy, &accepting)
+	}
+
+	i.warm.mu.Lock()
+	warmSize := i.warm.size
+	i.warm.mu.Unlock()
+	if warmSize > 0 {
+		go i.runWarmPool(ctx)
+	}
+
+	if pacAddr != "" {
+		stop, err := i.servePAC(pacAddr)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	if h, ok := redirect.(*hostsRedirect); ok && intercept {
+		watching := make(chan struct{})
+		go func() {
+			defer close(watching)
+			i.runHostsWatch(ctx, h)
+		}()
+		defer func() { <-watching }()
+	}
 
 	<-ctx.Done()
-	i.wg.Wait()
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	accepting.Wait()
+	i.drain()
 	return nil
 }
 
-func (i *Interceptor) handleConnection(client net.Conn) {
+func (i *Interceptor) serve(ctx context.Context, listener net.Listener, handle func(context.Context, net.Conn), accepting *sync.WaitGroup) {
+	defer accepting.Done()
+	defer output.Recover("listener")
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		i.wg.Add(1)
+		go handle(ctx, conn)
+	}
+}
+
+func (i *Interceptor) handleConnection(ctx context.Context, client net.Conn) {
 	defer i.wg.Done()
+	defer output.Recover("connection handler")
 	defer client.Close()
+	defer i.track(client, true)()
 	defer atomic.AddInt64(&i.connCount, -1)
 
 	atomic.AddInt64(&i.connCount, 1)
 	atomic.AddInt64(&i.totalConns, 1)
 	idleexit.Reset()
 
-	for attempt := 0; attempt < 3; attempt++ {
-		i.mu.RLock()
-		var p *proxy.Proxy
-		if len(i.proxies) > 0 {
-			index := rand.Intn(len(i.proxies))
-			p = i.proxies[index]
+	serverName, client, err := peekServerName(client)
+	if answerProbe(serverName, client) {
+		return
+	}
+	if err != nil {
+		output.Info("Could not read TLS ClientHello: %v", err)
+		if i.debug {
+			fmt.Printf("Could not read TLS ClientHello: %v\n", err)
 		}
-		i.mu.RUnlock()
+	}
+	upstream, err := i.route(serverName)
+	if err == nil && i.watchPaused() {
+		err = errHostsPaused
+	}
+	if err != nil {
+		fmt.Printf("[%s] Rejected connection: %v\n", time.Now().Format("15:04:05"), err)
+		output.Warn("Rejected connection: %v", err)
+		return
+	}
+	host := serverName
+	if host == "" {
+		host = "(no SNI)"
+	}
+	output.Info("Connection for %s to %s", host, upstream)
 
-		if p != nil {
-			proxyType := "SOCKS5"
-			if p.Type == proxy.HTTPS {
-				proxyType = "HTTPS"
-			}
-			fmt.Printf("[%s] Connection via %s %s\n", time.Now().Format("15:04:05"), proxyType, p.Address)
-			output.Info("Connection via %s proxy %s", proxyType, p.Address)
-		} else {
-			fmt.Printf("[%s] Connection direct\n", time.Now().Format("15:04:05"))
-			output.Info("Connection direct")
+	rule, ok := i.checkRule(serverName, host)
+	if !ok {
+		return
+	}
+
+	target, p := i.dialUpstream(ctx, client, host, upstream, rule)
+	if target == nil {
+		return
+	}
+	i.relay(client, target, p)
+}
+
+func (i *Interceptor) checkRule(name, host string) (*Rule, bool) {
+	rule := i.matchRule(name)
+	if rule == nil {
+		return nil, true
+	}
+	output.Info("%s: matched rule %s", host, rule)
+	if rule.Action == RuleReject {
+		fmt.Printf("[%s] %s: rejected by rule %s\n", time.Now().Format("15:04:05"), host, rule)
+		return rule, false
+	}
+	return rule, true
+}
+
+func (i *Interceptor) dialUpstream(ctx context.Context, client net.Conn, host, upstream string, rule *Rule) (net.Conn, *proxy.Proxy) {
+	i.mu.RLock()
+	policy := i.retry
+	i.mu.RUnlock()
+
+	wait, err := i.waitForSlot(ctx, i.tryConnSlot)
+	if err != nil {
+		fmt.Printf("[%s] %s: no free connection slot after %v\n", time.Now().Format("15:04:05"), host, wait.Round(time.Millisecond))
+		output.Warn("%s: no free connection slot after %v: %v", host, wait.Round(time.Millisecond), err)
+		return nil, nil
+	}
+	if wait > 0 {
+		output.Info("%s: queued %v for a connection slot", host, wait.Round(time.Millisecond))
+	}
+
+	key := i.sessionKey(client)
+	if rule != nil && rule.Group != "" && key != "" {
+		key += " group " + rule.Group
+	}
+	filter := newAttemptFilter()
+	var target net.Conn
+	var p *proxy.Proxy
+	for attempt := 0; attempt < policy.Attempts && target == nil; attempt++ {
+		if err := policy.wait(ctx, attempt); err != nil {
+			break
 		}
 
-		target, err := i.connectTo(domain+":443", p)
+		var proxies []*proxy.Proxy
+		var pickErr error
+		wait, err := i.waitForSlot(ctx, func() bool {
+			proxies, pickErr = i.pickAttempt(key, filter, rule)
+			return !errors.Is(pickErr, errSaturated)
+		})
+		if err == nil {
+			err = pickErr
+			if wait > 0 {
+				output.Info("%s: queued %v for a proxy below its connection limit", host, wait.Round(time.Millisecond))
+			}
+		}
 		if err != nil {
 			output.Info("Connection failed: %v", err)
 			if i.debug {
@@ -128,35 +365,267 @@ func (i *Interceptor) handleConnection(client net.Conn) {
 			}
 			continue
 		}
+
+		if conn, warm := i.takeWarm(proxies, upstream); conn != nil {
+			fmt.Printf("[%s] %s: connection via %s (warm tunnel)\n", time.Now().Format("15:04:05"), host, warm.Label())
+			output.Info("%s: connection via proxy %s using a warm tunnel", host, warm.Label())
+			target, p = conn, warm
+			break
+		}
+
+		if len(proxies) > 1 {
+			fmt.Printf("[%s] %s: racing %d proxies\n", time.Now().Format("15:04:05"), host, len(proxies))
+			output.Info("%s: racing %d proxies", host, len(proxies))
+		} else if proxies[0] != nil {
+			fmt.Printf("[%s] %s: connection via %s\n", time.Now().Format("15:04:05"), host, proxies[0].Label())
+			output.Info("%s: connection via proxy %s", host, proxies[0].Label())
+		} else {
+			fmt.Printf("[%s] %s: connection direct\n", time.Now().Format("15:04:05"), host)
+			output.Info("%s: connection direct", host)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, policy.Timeout)
+		target, p, err = i.dialRace(attemptCtx, upstream, proxies, filter)
+		cancel()
+		if err != nil {
+			if len(proxies) == 1 && proxies[0] != nil {
+				i.dropSession(key, proxies[0])
+			}
+			output.Info("Connection failed (%s): %v", Classify(err), err)
+			if i.debug {
+				fmt.Printf("Connection failed (%s): %v\n", Classify(err), err)
+			}
+			continue
+		}
+
+		if p != nil && len(proxies) > 1 {
+			fmt.Printf("[%s] %s: connection via %s (won race)\n", time.Now().Format("15:04:05"), host, p.Label())
+			output.Info("%s: connection via proxy %s won race", host, p.Label())
+		}
+	}
+
+	if target == nil {
+		i.releaseConnSlot()
+		output.Info("All connection attempts failed")
+		if i.debug {
+			fmt.Printf("All connection attempts failed\n")
+		}
+		return nil, nil
+	}
+
+	i.pinSession(key, p)
+	return &slotConn{Conn: target, release: i.releaseConnSlot}, p
+}
+
+func (i *Interceptor) relay(client, target net.Conn, p *proxy.Proxy) {
+	defer target.Close()
+	defer i.track(target, false)()
+
+	upload := []*bandwidth.Limiter{bandwidth.NewLimiter(bandwidth.PerConn.Upload.Get)}
+	download := []*bandwidth.Limiter{bandwidth.NewLimiter(bandwidth.PerConn.Download.Get)}
+	if p != nil {
+		stats := i.statsFor(p)
+		atomic.AddInt64(&stats.active, 1)
+		defer atomic.AddInt64(&stats.active, -1)
+		upload = append(upload, stats.upload)
+		download = append(download, stats.download)
+	}
+
+	go func() {
 		defer target.Close()
+		defer output.Recover("relay")
+		io.Copy(target, bandwidth.WrapReader(client, upload...))
+	}()
+	io.Copy(bandwidth.WrapWriter(client, download...), target)
+}
 
-		go io.Copy(target, bandwidth.WrapReader(client))
-		io.Copy(bandwidth.WrapWriter(client), target)
-		return
+func (i *Interceptor) pickAttempt(key string, filter *attemptFilter, rule *Rule) ([]*proxy.Proxy, error) {
+	if rule != nil && rule.Action == RuleDirect {
+		return []*proxy.Proxy{nil}, nil
+	}
+
+	exclude := filter.excludes
+	if rule != nil && rule.Group != "" {
+		exclude = func(p *proxy.Proxy) bool {
+			return p.Group != rule.Group || filter.excludes(p)
+		}
+	}
+
+	if p := i.sessionProxy(key); p != nil {
+		if !exclude(p) {
+			filter.tried[p] = true
+			return []*proxy.Proxy{p}, nil
+		}
+		i.statsFor(p).releaseClaim()
+		i.releaseProxySlot(p)
+	}
+
+	i.mu.RLock()
+	race := i.race
+	i.mu.RUnlock()
+
+	var proxies []*proxy.Proxy
+	for len(proxies) == 0 || len(proxies) < race {
+		p, err := i.pickProxy(exclude)
+		if p == nil {
+			if len(proxies) == 0 && rule != nil && rule.Group != "" {
+				if err != nil {
+					return nil, fmt.Errorf("group %s: %w", rule.Group, err)
+				}
+				return nil, fmt.Errorf("no proxy available in group %s", rule.Group)
+			}
+			if len(proxies) == 0 {
+				return []*proxy.Proxy{nil}, err
+			}
+			break
+		}
+		proxies = append(proxies, p)
+		filter.tried[p] = true
+	}
+	return proxies, nil
+}
+
+func (i *Interceptor) pickProxy(exclude func(*proxy.Proxy) bool) (*proxy.Proxy, error) {
+	i.mu.RLock()
+	proxies := i.proxies
+	selector := i.selector
+	i.mu.RUnlock()
+
+	if len(proxies) == 0 {
+		return nil, nil
+	}
+
+	saturated := false
+	candidates := make([]Candidate, 0, len(proxies))
+	for _, p := range proxies {
+		stats := i.statsFor(p)
+		if (exclude != nil && exclude(p)) || !stats.available() {
+			continue
+		}
+		if stats.saturated(p.MaxConns) {
+			saturated = true
+			continue
+		}
+		candidates = append(candidates, Candidate{Proxy: p, Stats: stats.snapshot()})
+	}
+
+	for len(candidates) > 0 {
+		p := selector.Select(candidates)
+		if p == nil {
+			break
+		}
+		ok, full := i.reserve(p)
+		if ok {
+			return p, nil
+		}
+		saturated = saturated || full
+		candidates = removeCandidate(candidates, p)
+	}
+	if saturated {
+		return nil, errSaturated
 	}
+	return nil, errNoProxyAvailable
+}
 
-	output.Info("All connection attempts failed")
-	if i.debug {
-		fmt.Printf("All connection attempts failed\n")
+func removeCandidate(candidates []Candidate, p *proxy.Proxy) []Candidate {
+	var rest []Candidate
+	for _, c := range candidates {
+		if c.Proxy != p {
+			rest = append(rest, c)
+		}
 	}
+	return rest
 }
 
-func (i *Interceptor) connectTo(addr string, p *proxy.Proxy) (net.Conn, error) {
+func (i *Interceptor) dial(ctx context.Context, addr string, p *proxy.Proxy) (net.Conn, error) {
+	start := time.Now()
+	conn, err := i.connectTo(ctx, addr, p)
 	if p == nil {
-		return net.DialTimeout("tcp", addr, 1*time.Second)
+		return conn, err
+	}
+
+	stats := i.statsFor(p)
+	if err != nil {
+		i.releaseProxySlot(p)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			stats.recordSlow(time.Since(start))
+			return nil, err
+		}
+		if stats.recordFailure() {
+			fmt.Printf("[%s] Circuit open: %s\n", time.Now().Format("15:04:05"), p.Label())
+			output.Warn("Circuit opened for %s: %v", p.Label(), err)
+		}
+		return nil, err
+	}
+	if stats.recordSuccess(time.Since(start)) {
+		output.Info("Circuit closed for %s", p.Label())
+	}
+	return &slotConn{Conn: conn, release: func() { i.releaseProxySlot(p) }}, nil
+}
+
+func (i *Interceptor) connectTo(ctx context.Context, addr string, p *proxy.Proxy) (net.Conn, error) {
+	if p == nil {
+		return i.dialDirect(ctx, addr)
+	}
+
+	hops := p.Hops()
+	conn, err := dialProxy(ctx, hops[0])
+	if err != nil {
+		return nil, hopError(hops, 0, err)
 	}
 
+	raw := conn
+	stop := context.AfterFunc(ctx, func() {
+		raw.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	for n, hop := range hops {
+		target := addr
+		if n+1 < len(hops) {
+			target = hops[n+1].Address
+		}
+
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if ctx.Err() != nil {
+			conn.Close()
+			return nil, ctx.Err()
+		}
+		conn, err = i.handshake(conn, target, hop)
+		if err == nil && n+1 < len(hops) && hops[n+1].TLS != nil {
+			conn, err = wrapTLS(ctx, conn, hops[n+1])
+			if err != nil {
+				return nil, hopError(hops, n+1, err)
+			}
+		}
+		if err != nil {
+			return nil, hopError(hops, n, err)
+		}
+	}
+
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (i *Interceptor) handshake(conn net.Conn, addr string, p *proxy.Proxy) (net.Conn, error) {
 	switch p.Type {
 	case proxy.SOCKS5:
-		return i.connectViaSocks5(addr, p)
-	case proxy.HTTPS:
-		return i.connectViaHTTPS(addr, p)
+		return i.connectViaSocks5(conn, addr, p)
+	case proxy.HTTP, proxy.HTTPS:
+		return i.connectViaHTTP(conn, addr, p)
+	case proxy.SOCKS4, proxy.SOCKS4A:
+		return i.connectViaSocks4(conn, addr, p)
 	default:
+		conn.Close()
 		return nil, fmt.Errorf("unsupported proxy type")
 	}
 }
 
-func (i *Interceptor) connectViaSocks5(addr string, p *proxy.Proxy) (net.Conn, error) {
+func (i *Interceptor) connectViaSocks5(conn net.Conn, addr string, p *proxy.Proxy) (net.Conn, error) {
 	var auth *socks.Auth
 	if p.Auth != nil {
 		if password, ok := p.Auth.Password(); ok {
@@ -167,21 +636,20 @@ func (i *Interceptor) connectViaSocks5(addr string, p *proxy.Proxy) (net.Conn, e
 		}
 	}
 
-	baseDialer := &net.Dialer{Timeout: 1 * time.Second}
-	dialer, err := socks.SOCKS5("tcp", p.Address, auth, baseDialer)
+	dialer, err := socks.SOCKS5("tcp", p.Address, auth, connDialer{conn})
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	return dialer.Dial("tcp", addr)
-}
-
-func (i *Interceptor) connectViaHTTPS(addr string, p *proxy.Proxy) (net.Conn, error) {
-	conn, err := net.DialTimeout("tcp", p.Address, 1*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to proxy: %v", err)
+	target, err := dialer.Dial("tcp", addr)
+	if err != nil && strings.Contains(err.Error(), "authentication") {
+		return nil, fmt.Errorf("%w: %v", errProxyAuth, err)
 	}
+	return target, err
+}
 
+func (i *Interceptor) connectViaHTTP(conn net.Conn, addr string, p *proxy.Proxy) (net.Conn, error) {
 	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
 
 	if p.Auth != nil {
@@ -194,19 +662,23 @@ func (i *Interceptor) connectViaHTTPS(addr string, p *proxy.Proxy) (net.Conn, er
 
 	connectReq += "\r\n"
 
-	_, err = conn.Write([]byte(connectReq))
+	_, err := conn.Write([]byte(connectReq))
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to send CONNECT request: %v", err)
+		return nil, fmt.Errorf("failed to send CONNECT request: %w", err)
 	}
 
 	reader := bufio.NewReader(conn)
 	resp, _, err := reader.ReadLine()
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to read CONNECT response: %v", err)
+		return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
 	}
 
+	if strings.Contains(string(resp), "407") {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", errProxyAuth, string(resp))
+	}
 	if !strings.Contains(string(resp), "200") {
 		conn.Close()
 		return nil, fmt.Errorf("CONNECT failed: %s", string(resp))
@@ -219,69 +691,96 @@ func (i *Interceptor) connectViaHTTPS(addr string, p *proxy.Proxy) (net.Conn, er
 		}
 	}
 
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
 	return conn, nil
 }
 
-func (i *Interceptor) addHostsEntry() error {
-	lines, err := i.readHosts()
+func (i *Interceptor) dialDirect(ctx context.Context, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
-		return err
-	}
-
-	for _, line := range lines {
-		if strings.Contains(line, domain) && strings.Contains(line, "127.0.0.1") {
-			return nil
-		}
+		return nil, err
 	}
 
-	lines = append(lines, hostsLine)
-	return i.writeHosts(lines)
-}
+	i.mu.RLock()
+	r := i.resolver
+	i.mu.RUnlock()
 
-func (i *Interceptor) removeHostsEntry() error {
-	lines, err := i.readHosts()
+	ips, err := r.LookupIP(ctx, host)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var newLines []string
-	for _, line := range lines {
-		if strings.Contains(line, domain) && strings.Contains(line, "DAX_INTERCEPT") {
+	var dialer net.Dialer
+	lastErr := error(errSelfDial)
+	for _, ip := range ips {
+		target := net.JoinHostPort(ip.String(), port)
+		if i.isListener(target) {
+			output.Warn("Refusing to dial %s for %s: %v", target, host, errSelfDial)
 			continue
 		}
-		newLines = append(newLines, line)
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
 	}
+	return nil, fmt.Errorf("%s: %w", host, lastErr)
+}
 
-	return i.writeHosts(newLines)
+func (i *Interceptor) addListening(addr net.Addr) {
+	i.mu.Lock()
+	i.listening = append(i.listening, addr)
+	i.mu.Unlock()
 }
 
-func (i *Interceptor) readHosts() ([]string, error) {
-	file, err := os.Open(hostsFile)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
+func (i *Interceptor) setListening(addrs []net.Addr) {
+	i.mu.Lock()
+	i.listening = addrs
+	i.mu.Unlock()
+}
 
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+func (i *Interceptor) isListener(addr string) bool {
+	target, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil || target.IP == nil {
+		return false
 	}
 
-	return lines, scanner.Err()
+	i.mu.RLock()
+	listening := i.listening
+	i.mu.RUnlock()
+
+	for _, l := range listening {
+		bound, ok := l.(*net.TCPAddr)
+		if !ok || bound.Port != target.Port {
+			continue
+		}
+		if target.IP.Equal(bound.IP) || target.IP.IsUnspecified() {
+			return true
+		}
+		if bound.IP.IsUnspecified() && isLocalIP(target.IP) {
+			return true
+		}
+	}
+	return false
 }
 
-func (i *Interceptor) writeHosts(lines []string) error {
-	file, err := os.Create(hostsFile)
+func isLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		return err
+		return false
 	}
-	defer file.Close()
-
-	writer := bufio.NewWriter(file)
-	for _, line := range lines {
-		fmt.Fprintln(writer, line)
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
 	}
-
-	return writer.Flush()
+	return false
 }
@@ -0,0 +1,103 @@
+package hosts
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"daxwalkerfix/internal/proxy"
+)
+
+func TestIsListenerCoversEveryBoundAddress(t *testing.T) {
+	i := New(nil, false)
+	i.SetIntercept(false)
+	i.SetLocalProxy(LocalProxy{Addr: "127.0.0.1:0"})
+	i.SetPAC("127.0.0.1:0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- i.Start(ctx) }()
+
+	var listening []net.Addr
+	for deadline := time.Now().Add(5 * time.Second); len(listening) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d bound addresses, want 2", len(listening))
+		}
+		time.Sleep(10 * time.Millisecond)
+		i.mu.RLock()
+		listening = i.listening
+		i.mu.RUnlock()
+	}
+
+	for _, addr := range listening {
+		if !i.isListener(addr.String()) {
+			t.Errorf("%s is bound but not treated as a listener", addr)
+		}
+	}
+	if i.isListener("203.0.113.1:443") {
+		t.Error("a remote address is treated as a listener")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range listening {
+		if i.isListener(addr.String()) {
+			t.Errorf("%s is still treated as a listener after Start returned", addr)
+		}
+	}
+}
+
+func TestIsListenerUnspecifiedBind(t *testing.T) {
+	i := New(nil, false)
+	i.setListening([]net.Addr{&net.TCPAddr{IP: net.IPv4zero, Port: 8080}})
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:8080", true},
+		{"[::1]:8080", true},
+		{"0.0.0.0:8080", true},
+		{"127.0.0.1:443", false},
+		{"203.0.113.1:8080", false},
+		{"not an address", false},
+	}
+	for _, tt := range tests {
+		if got := i.isListener(tt.addr); got != tt.want {
+			t.Errorf("isListener(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateProxiesKeepsStatsUntilDrained(t *testing.T) {
+	p := &proxy.Proxy{Address: "10.0.0.1:1080", Type: proxy.SOCKS5}
+	i := New([]*proxy.Proxy{p}, false)
+
+	if ok, _ := i.reserve(p); !ok {
+		t.Fatal("could not reserve a slot")
+	}
+	held := i.statsFor(p)
+	i.UpdateProxies(nil)
+	if i.statsFor(p) != held {
+		t.Fatal("stats were dropped while a slot was still held")
+	}
+
+	i.releaseProxySlot(p)
+	if got := i.ProxyStats(p).Conns; got != 0 {
+		t.Errorf("got %d conns after release, want 0", got)
+	}
+
+	i.UpdateProxies(nil)
+	i.statsMu.Lock()
+	_, ok := i.stats[p]
+	i.statsMu.Unlock()
+	if ok {
+		t.Error("stats for a removed proxy were kept after draining")
+	}
+	if held.acquire(0) {
+		t.Error("a retired entry handed out a slot")
+	}
+}
@@ -0,0 +1,342 @@
+package hosts
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"daxwalkerfix/internal/idleexit"
+	"daxwalkerfix/internal/output"
+)
+
+const (
+	socks5Version      = 5
+	socks5NoAuth       = 0x00
+	socks5UserPass     = 0x02
+	socks5NoAcceptable = 0xff
+	socks5Connect      = 1
+
+	socks5Succeeded          = 0x00
+	socks5GeneralFailure     = 0x01
+	socks5NotAllowed         = 0x02
+	socks5HostUnreachable    = 0x04
+	socks5CommandUnsupported = 0x07
+	socks5AddressUnsupported = 0x08
+)
+
+var errLocalAuth = errors.New("local proxy authentication failed")
+
+type LocalProxy struct {
+	Addr  string
+	Auth  *url.Userinfo
+	Allow []string
+}
+
+func (i *Interceptor) SetIntercept(enabled bool) {
+	i.mu.Lock()
+	i.intercept = enabled
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) SetLocalProxy(local LocalProxy) {
+	var patterns []string
+	for _, pattern := range local.Allow {
+		if pattern = normalizeName(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	local.Allow = patterns
+
+	i.mu.Lock()
+	i.localProxy = local
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) handleLocalProxy(ctx context.Context, client net.Conn) {
+	defer i.wg.Done()
+	defer output.Recover("local proxy handler")
+	defer client.Close()
+	defer i.track(client, true)()
+	defer atomic.AddInt64(&i.connCount, -1)
+
+	atomic.AddInt64(&i.connCount, 1)
+	atomic.AddInt64(&i.totalConns, 1)
+	idleexit.Reset()
+
+	i.mu.RLock()
+	local := i.localProxy
+	i.mu.RUnlock()
+
+	client.SetDeadline(time.Now().Add(handshakeTimeout))
+	reader := bufio.NewReader(client)
+	first, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+
+	var proto localProtocol
+	if first[0] == socks5Version {
+		proto = &socks5Server{reader: reader, conn: client}
+	} else {
+		proto = &httpConnectServer{reader: reader, conn: client}
+	}
+
+	addr, err := proto.accept(local.Auth)
+	if err != nil {
+		output.Info("Local proxy request from %s failed: %v", client.RemoteAddr(), err)
+		return
+	}
+	client.SetDeadline(time.Time{})
+
+	host, _, _ := net.SplitHostPort(addr)
+	if !localAllowed(local.Allow, host) {
+		fmt.Printf("[%s] %s: not in the local proxy allowlist\n", time.Now().Format("15:04:05"), addr)
+		output.Warn("Local proxy refused %s: not in allowlist", addr)
+		proto.reply(socks5NotAllowed)
+		return
+	}
+	if i.watchPaused() {
+		fmt.Printf("[%s] %s: %v\n", time.Now().Format("15:04:05"), addr, errHostsPaused)
+		proto.reply(socks5NotAllowed)
+		return
+	}
+	output.Info("Local proxy connection for %s", addr)
+
+	rule, ok := i.checkRule(host, addr)
+	if !ok {
+		proto.reply(socks5NotAllowed)
+		return
+	}
+
+	target, p := i.dialUpstream(ctx, client, addr, addr, rule)
+	if target == nil {
+		proto.reply(socks5HostUnreachable)
+		return
+	}
+	if err := proto.reply(socks5Succeeded); err != nil {
+		target.Close()
+		return
+	}
+	i.relay(&bufferedConn{Conn: client, reader: reader}, target, p)
+}
+
+func localAllowed(allow []string, host string) bool {
+	if len(allow) == 0 {
+		return true
+	}
+	host = normalizeName(host)
+	for _, pattern := range allow {
+		if matchPattern(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkLocalAuth(auth *url.Userinfo, user, pass string) bool {
+	wantPass, _ := auth.Password()
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(auth.Username())) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(wantPass)) == 1
+	return userOK && passOK
+}
+
+type localProtocol interface {
+	accept(auth *url.Userinfo) (string, error)
+	reply(code byte) error
+}
+
+type socks5Server struct {
+	reader *bufio.Reader
+	conn   net.Conn
+}
+
+func (s *socks5Server) accept(auth *url.Userinfo) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(s.reader, header); err != nil {
+		return "", err
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(s.reader, methods); err != nil {
+		return "", err
+	}
+
+	want := byte(socks5NoAuth)
+	if auth != nil {
+		want = socks5UserPass
+	}
+	if !containsByte(methods, want) {
+		s.conn.Write([]byte{socks5Version, socks5NoAcceptable})
+		return "", fmt.Errorf("client offered no acceptable SOCKS5 auth method")
+	}
+	if _, err := s.conn.Write([]byte{socks5Version, want}); err != nil {
+		return "", err
+	}
+	if auth != nil {
+		if err := s.authenticate(auth); err != nil {
+			return "", err
+		}
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(s.reader, req); err != nil {
+		return "", err
+	}
+	if req[0] != socks5Version {
+		return "", fmt.Errorf("bad SOCKS5 version %d", req[0])
+	}
+	if req[1] != socks5Connect {
+		s.reply(socks5CommandUnsupported)
+		return "", fmt.Errorf("unsupported SOCKS5 command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case 1, 4:
+		ip := make([]byte, net.IPv4len)
+		if req[3] == 4 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(s.reader, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		length, err := s.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(s.reader, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		s.reply(socks5AddressUnsupported)
+		return "", fmt.Errorf("unsupported SOCKS5 address type %d", req[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(s.reader, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+func (s *socks5Server) authenticate(auth *url.Userinfo) error {
+	version, err := s.reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != 1 {
+		return fmt.Errorf("bad SOCKS5 auth version %d", version)
+	}
+	user, err := s.readField()
+	if err != nil {
+		return err
+	}
+	pass, err := s.readField()
+	if err != nil {
+		return err
+	}
+
+	if !checkLocalAuth(auth, user, pass) {
+		s.conn.Write([]byte{1, 1})
+		return errLocalAuth
+	}
+	_, err = s.conn.Write([]byte{1, 0})
+	return err
+}
+
+func (s *socks5Server) readField() (string, error) {
+	length, err := s.reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	field := make([]byte, length)
+	_, err = io.ReadFull(s.reader, field)
+	return string(field), err
+}
+
+func (s *socks5Server) reply(code byte) error {
+	_, err := s.conn.Write([]byte{socks5Version, code, 0, 1, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func containsByte(b []byte, c byte) bool {
+	for _, v := range b {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+type httpConnectServer struct {
+	reader *bufio.Reader
+	conn   net.Conn
+}
+
+func (h *httpConnectServer) accept(auth *url.Userinfo) (string, error) {
+	req, err := http.ReadRequest(h.reader)
+	if err != nil {
+		return "", err
+	}
+	if req.Method != http.MethodConnect {
+		h.respond("405 Method Not Allowed", "Allow: CONNECT\r\n")
+		return "", fmt.Errorf("unsupported HTTP method %s", req.Method)
+	}
+
+	if auth != nil {
+		user, pass, ok := parseProxyAuthorization(req.Header.Get("Proxy-Authorization"))
+		if !ok || !checkLocalAuth(auth, user, pass) {
+			h.respond("407 Proxy Authentication Required", "Proxy-Authenticate: Basic realm=\"daxwalkerfix\"\r\n")
+			return "", errLocalAuth
+		}
+	}
+
+	addr := req.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "443")
+	}
+	return addr, nil
+}
+
+func (h *httpConnectServer) reply(code byte) error {
+	switch code {
+	case socks5Succeeded:
+		return h.respond("200 Connection established", "")
+	case socks5NotAllowed:
+		return h.respond("403 Forbidden", "")
+	default:
+		return h.respond("502 Bad Gateway", "")
+	}
+}
+
+func (h *httpConnectServer) respond(status, headers string) error {
+	_, err := fmt.Fprintf(h.conn, "HTTP/1.1 %s\r\n%s\r\n", status, headers)
+	return err
+}
+
+func parseProxyAuthorization(header string) (string, string, bool) {
+	scheme, encoded, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
@@ -0,0 +1,69 @@
+package hosts
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"daxwalkerfix/internal/output"
+)
+
+const pacContentType = "application/x-ns-proxy-autoconfig"
+
+func (i *Interceptor) SetPAC(addr string) {
+	i.mu.Lock()
+	i.pacAddr = addr
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) PAC() string {
+	i.mu.RLock()
+	domains := i.domains
+	local := i.localProxy.Addr
+	i.mu.RUnlock()
+
+	host, port, _ := net.SplitHostPort(local)
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	proxyAddr := net.JoinHostPort(host, port)
+
+	var conditions []string
+	for _, d := range domains {
+		if suffix, ok := strings.CutPrefix(d.Name, "*."); ok {
+			conditions = append(conditions, "dnsDomainIs(host, "+strconv.Quote("."+suffix)+")")
+		} else {
+			conditions = append(conditions, "host == "+strconv.Quote(d.Name))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("\thost = host.toLowerCase();\n")
+	fmt.Fprintf(&b, "\tif (%s)\n", strings.Join(conditions, " ||\n\t    "))
+	fmt.Fprintf(&b, "\t\treturn \"SOCKS5 %[1]s; SOCKS %[1]s; PROXY %[1]s\";\n", proxyAddr)
+	b.WriteString("\treturn \"DIRECT\";\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (i *Interceptor) servePAC(addr string) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve PAC file on %s: %v", addr, err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		output.Info("PAC file requested by %s", r.RemoteAddr)
+		w.Header().Set("Content-Type", pacContentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(w, i.PAC())
+	})}
+	i.addListening(listener.Addr())
+	go server.Serve(listener)
+	output.Info("PAC file served at http://%s/proxy.pac", listener.Addr())
+	return func() { server.Shutdown(context.Background()) }, nil
+}
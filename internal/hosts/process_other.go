@@ -0,0 +1,12 @@
+//go:build !windows
+
+package hosts
+
+import (
+	"fmt"
+	"net"
+)
+
+func processID(client, server net.Addr) (uint32, error) {
+	return 0, fmt.Errorf("process lookup is only supported on Windows")
+}
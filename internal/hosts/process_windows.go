@@ -0,0 +1,86 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	tcpTableOwnerPIDAll     = 5
+	errorInsufficientBuffer = 122
+	tcpTableAttempts        = 5
+	tcpTableSlack           = 16
+)
+
+var (
+	iphlpapi                = syscall.NewLazyDLL("iphlpapi.dll")
+	procGetExtendedTcpTable = iphlpapi.NewProc("GetExtendedTcpTable")
+)
+
+type tcpRowOwnerPID struct {
+	state      uint32
+	localAddr  uint32
+	localPort  uint32
+	remoteAddr uint32
+	remotePort uint32
+	owningPID  uint32
+}
+
+func processID(client, server net.Addr) (uint32, error) {
+	clientAddr, ok := client.(*net.TCPAddr)
+	if !ok {
+		return 0, fmt.Errorf("not a TCP connection")
+	}
+	serverAddr, ok := server.(*net.TCPAddr)
+	if !ok {
+		return 0, fmt.Errorf("not a TCP connection")
+	}
+
+	buf, err := tcpTable()
+	if err != nil {
+		return 0, err
+	}
+
+	count := *(*uint32)(unsafe.Pointer(&buf[0]))
+	rows := unsafe.Slice((*tcpRowOwnerPID)(unsafe.Pointer(&buf[4])), count)
+	for _, row := range rows {
+		if tablePort(row.localPort) == clientAddr.Port &&
+			tablePort(row.remotePort) == serverAddr.Port &&
+			tableIP(row.localAddr).Equal(clientAddr.IP) {
+			return row.owningPID, nil
+		}
+	}
+	return 0, fmt.Errorf("no process owns %s", clientAddr)
+}
+
+func tcpTable() ([]byte, error) {
+	var buf []byte
+	var size uint32
+	for attempt := 0; attempt < tcpTableAttempts; attempt++ {
+		var ptr uintptr
+		if len(buf) > 0 {
+			ptr = uintptr(unsafe.Pointer(&buf[0]))
+		}
+		ret, _, _ := procGetExtendedTcpTable.Call(ptr, uintptr(unsafe.Pointer(&size)), 0, syscall.AF_INET, tcpTableOwnerPIDAll, 0)
+		switch ret {
+		case 0:
+			return buf, nil
+		case errorInsufficientBuffer:
+			size += tcpTableSlack * uint32(unsafe.Sizeof(tcpRowOwnerPID{}))
+			buf = make([]byte, size)
+		default:
+			return nil, fmt.Errorf("GetExtendedTcpTable failed: %d", ret)
+		}
+	}
+	return nil, fmt.Errorf("GetExtendedTcpTable kept growing after %d attempts", tcpTableAttempts)
+}
+
+func tablePort(port uint32) int {
+	return int(port&0xff)<<8 | int(port>>8&0xff)
+}
+
+func tableIP(addr uint32) net.IP {
+	return net.IPv4(byte(addr), byte(addr>>8), byte(addr>>16), byte(addr>>24))
+}
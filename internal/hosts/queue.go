@@ -0,0 +1,167 @@
+package hosts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"daxwalkerfix/internal/proxy"
+)
+
+const DefaultQueueTimeout = 10 * time.Second
+
+var (
+	errSaturated    = errors.New("all proxies are at their connection limit")
+	errQueueTimeout = errors.New("timed out waiting for a free connection slot")
+)
+
+type QueueStats struct {
+	Depth   int64
+	Waited  int64
+	AvgWait time.Duration
+	MaxWait time.Duration
+}
+
+type slotQueue struct {
+	mu      sync.Mutex
+	freed   chan struct{}
+	depth   int64
+	waited  int64
+	total   time.Duration
+	longest time.Duration
+}
+
+func (q *slotQueue) changed() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.freed == nil {
+		q.freed = make(chan struct{})
+	}
+	return q.freed
+}
+
+func (q *slotQueue) notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.freed != nil {
+		close(q.freed)
+		q.freed = nil
+	}
+}
+
+func (q *slotQueue) record(wait time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.waited++
+	q.total += wait
+	if wait > q.longest {
+		q.longest = wait
+	}
+}
+
+func (i *Interceptor) SetConnLimit(max int, queueTimeout time.Duration) {
+	i.mu.Lock()
+	i.maxConns = max
+	i.queueTimeout = queueTimeout
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) QueueStats() QueueStats {
+	q := &i.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := QueueStats{
+		Depth:   atomic.LoadInt64(&q.depth),
+		Waited:  q.waited,
+		MaxWait: q.longest,
+	}
+	if q.waited > 0 {
+		stats.AvgWait = q.total / time.Duration(q.waited)
+	}
+	return stats
+}
+
+func (i *Interceptor) waitForSlot(ctx context.Context, try func() bool) (time.Duration, error) {
+	if try() {
+		return 0, nil
+	}
+
+	i.mu.RLock()
+	timeout := i.queueTimeout
+	i.mu.RUnlock()
+
+	start := time.Now()
+	atomic.AddInt64(&i.queue.depth, 1)
+	defer atomic.AddInt64(&i.queue.depth, -1)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		freed := i.queue.changed()
+		if try() {
+			wait := time.Since(start)
+			i.queue.record(wait)
+			return wait, nil
+		}
+		select {
+		case <-freed:
+		case <-timer.C:
+			return time.Since(start), errQueueTimeout
+		case <-ctx.Done():
+			return time.Since(start), ctx.Err()
+		}
+	}
+}
+
+func (i *Interceptor) tryConnSlot() bool {
+	i.mu.RLock()
+	max := int64(i.maxConns)
+	i.mu.RUnlock()
+
+	for {
+		open := atomic.LoadInt64(&i.openConns)
+		if max > 0 && open >= max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&i.openConns, open, open+1) {
+			return true
+		}
+	}
+}
+
+func (i *Interceptor) releaseConnSlot() {
+	atomic.AddInt64(&i.openConns, -1)
+	i.queue.notify()
+}
+
+func (i *Interceptor) reserve(p *proxy.Proxy) (ok, saturated bool) {
+	stats := i.statsFor(p)
+	if !stats.claim() {
+		return false, false
+	}
+	if !stats.acquire(p.MaxConns) {
+		stats.releaseClaim()
+		return false, true
+	}
+	return true, false
+}
+
+func (i *Interceptor) releaseProxySlot(p *proxy.Proxy) {
+	i.statsFor(p).releaseSlot()
+	i.queue.notify()
+}
+
+type slotConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *slotConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
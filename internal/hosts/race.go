@@ -0,0 +1,68 @@
+package hosts
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"daxwalkerfix/internal/output"
+	"daxwalkerfix/internal/proxy"
+)
+
+type dialResult struct {
+	proxy *proxy.Proxy
+	conn  net.Conn
+	err   error
+}
+
+func (i *Interceptor) dialRace(ctx context.Context, addr string, proxies []*proxy.Proxy, filter *attemptFilter) (net.Conn, *proxy.Proxy, error) {
+	if len(proxies) == 1 {
+		conn, err := i.dial(ctx, addr, proxies[0])
+		if Classify(err) == ErrAuth {
+			filter.recordAuthFailure(err)
+		}
+		return conn, proxies[0], err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan dialResult, len(proxies))
+	for _, p := range proxies {
+		go func(p *proxy.Proxy) {
+			r := dialResult{proxy: p, err: fmt.Errorf("dial via %s crashed", p.Label())}
+			defer func() { results <- r }()
+			defer output.Recover("raced dial")
+			r.conn, r.err = i.dial(ctx, addr, p)
+		}(p)
+	}
+
+	var errs []string
+	for n := range proxies {
+		r := <-results
+		if r.err != nil {
+			if Classify(r.err) == ErrAuth {
+				filter.recordAuthFailure(r.err)
+			}
+			errs = append(errs, fmt.Sprintf("%s: %v", r.proxy.Label(), r.err))
+			continue
+		}
+		cancel()
+		go closeLosers(results, len(proxies)-n-1)
+		return r.conn, r.proxy, nil
+	}
+
+	cancel()
+	return nil, nil, fmt.Errorf("all %d raced proxies failed: %s", len(proxies), strings.Join(errs, "; "))
+}
+
+func closeLosers(results <-chan dialResult, remaining int) {
+	for ; remaining > 0; remaining-- {
+		r := <-results
+		if r.conn != nil {
+			r.conn.Close()
+			output.Info("Race loser %s connected too late, closed", r.proxy.Label())
+		} else {
+			output.Info("Race loser %s: %v", r.proxy.Label(), r.err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"daxwalkerfix/internal/journal"
+	"daxwalkerfix/internal/output"
+	"daxwalkerfix/internal/resolver"
+)
+
+var Redirectors = []string{"hosts", "dns", "none"}
+
+type Redirector interface {
+	Apply(domains []Domain) error
+	Remove() error
+}
+
+type RedirectConfig struct {
+	Mode      string
+	HostsPath string
+	DNSAddr   string
+	Upstream  *resolver.Resolver
+}
+
+func NewRedirector(cfg RedirectConfig) (Redirector, error) {
+	switch strings.ToLower(cfg.Mode) {
+	case "hosts":
+		return &hostsRedirect{file: NewHostsFile(cfg.HostsPath)}, nil
+	case "dns":
+		for _, server := range cfg.Upstream.Servers() {
+			if server == cfg.DNSAddr {
+				return nil, fmt.Errorf("DNS server %s would forward queries to itself", cfg.DNSAddr)
+			}
+		}
+		return &dnsRedirect{addr: cfg.DNSAddr, upstream: cfg.Upstream}, nil
+	case "none":
+		return noneRedirect{}, nil
+	default:
+		return nil, fmt.Errorf("unknown redirect mode %q, expected one of: %s", cfg.Mode, strings.Join(Redirectors, ", "))
+	}
+}
+
+type noneRedirect struct{}
+
+func (noneRedirect) Apply(domains []Domain) error { return nil }
+func (noneRedirect) Remove() error                { return nil }
+
+type hostsRedirect struct {
+	file  *HostsFile
+	names []string
+}
+
+func (h *hostsRedirect) Apply(domains []Domain) error {
+	h.names = nil
+	for _, d := range domains {
+		if strings.HasPrefix(d.Name, "*.") {
+			output.Warn("The hosts file cannot redirect wildcard domain %s, use -redirect dns", d.Name)
+			continue
+		}
+		h.names = append(h.names, d.Name)
+	}
+
+	ip, _, _ := net.SplitHostPort(listenAddr)
+	conflicts, err := h.file.Conflicts(h.names, ip)
+	if err != nil {
+		return fmt.Errorf("failed to read hosts file: %v", err)
+	}
+	for _, c := range conflicts {
+		fmt.Printf("WARNING: %s line %d points %s at %s and may take priority over ours\n", h.file.Path, c.Line, c.Name, c.IP)
+		output.Warn("Hosts file %s line %d maps %s to %s, which may shadow our entry", h.file.Path, c.Line, c.Name, c.IP)
+	}
+
+	err = journal.Write(journal.Entry{
+		PID:       os.Getpid(),
+		Started:   time.Now(),
+		HostsFile: h.file.Path,
+		IP:        ip,
+		Names:     h.names,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write recovery journal: %v", err)
+	}
+	if err := h.file.AddEntries(h.names, ip); err != nil {
+		return fmt.Errorf("failed to modify hosts file: %v", err)
+	}
+	return nil
+}
+
+func (h *hostsRedirect) Remove() error {
+	if _, err := h.file.RemoveEntries(h.names); err != nil {
+		output.Error("Failed to restore hosts file: %v", err)
+		return err
+	}
+	return journal.Clear()
+}
+
+func RecoverUncleanShutdown() (int, error) {
+	entry, err := journal.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read recovery journal: %v", err)
+	}
+	if entry == nil {
+		return 0, nil
+	}
+	if entry.OwnerRunning() {
+		return 0, fmt.Errorf("another instance (pid %d) is already running, delete %s if it is not", entry.PID, journal.Path())
+	}
+
+	removed, err := NewHostsFile(entry.HostsFile).RemoveEntries(entry.Names)
+	if err != nil {
+		return 0, fmt.Errorf("failed to undo hosts entries left by pid %d: %v", entry.PID, err)
+	}
+	output.Warn("Removed %d hosts entries left by an unclean shutdown at %s", removed, entry.Started.Format(time.DateTime))
+	return removed, journal.Clear()
+}
@@ -0,0 +1,128 @@
+package hosts
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"daxwalkerfix/internal/proxy"
+)
+
+const (
+	MaxAttempts = 10
+	MaxBackoff  = 5 * time.Second
+)
+
+var errProxyAuth = errors.New("proxy authentication failed")
+
+type RetryPolicy struct {
+	Attempts int
+	Timeout  time.Duration
+	Backoff  time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts: 3,
+		Timeout:  3 * time.Second,
+	}
+}
+
+func (r RetryPolicy) wait(ctx context.Context, attempt int) error {
+	if attempt == 0 || r.Backoff <= 0 {
+		return nil
+	}
+
+	delay := r.Backoff
+	for n := 1; n < attempt && delay < MaxBackoff; n++ {
+		delay *= 2
+	}
+	delay = min(delay, MaxBackoff)
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay)))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type ErrorKind int
+
+const (
+	ErrOther ErrorKind = iota
+	ErrAuth
+	ErrRefused
+	ErrTimeout
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrAuth:
+		return "auth failure"
+	case ErrRefused:
+		return "refused"
+	case ErrTimeout:
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+func Classify(err error) ErrorKind {
+	if err == nil {
+		return ErrOther
+	}
+	if errors.Is(err, errProxyAuth) {
+		return ErrAuth
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "refused") {
+		return ErrRefused
+	}
+	return ErrOther
+}
+
+type attemptFilter struct {
+	tried   map[*proxy.Proxy]bool
+	badAuth map[string]bool
+}
+
+func newAttemptFilter() *attemptFilter {
+	return &attemptFilter{
+		tried:   make(map[*proxy.Proxy]bool),
+		badAuth: make(map[string]bool),
+	}
+}
+
+func (f *attemptFilter) excludes(p *proxy.Proxy) bool {
+	if f.tried[p] {
+		return true
+	}
+	for _, hop := range p.Hops() {
+		if hop.Auth != nil && f.badAuth[hop.Auth.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *attemptFilter) recordAuthFailure(err error) {
+	var hopErr *HopError
+	if errors.As(err, &hopErr) && hopErr.Proxy.Auth != nil {
+		f.badAuth[hopErr.Proxy.Auth.String()] = true
+	}
+}
@@ -0,0 +1,93 @@
+package hosts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"daxwalkerfix/internal/proxy"
+)
+
+func stallingListener(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		listener.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return listener
+}
+
+func TestClassifyHTTPConnectTimeout(t *testing.T) {
+	listener := stallingListener(t)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(50 * time.Millisecond))
+
+	p := &proxy.Proxy{Address: listener.Addr().String(), Type: proxy.HTTP}
+	_, err = New(nil, false).connectViaHTTP(conn, "walker.dax.cloud:443", p)
+	if err == nil {
+		t.Fatal("expected the stalled CONNECT to fail")
+	}
+	if kind := Classify(err); kind != ErrTimeout {
+		t.Errorf("classified %q as %s, want timeout", err, kind)
+	}
+}
+
+func TestClassifyDialProxyTimeout(t *testing.T) {
+	listener := stallingListener(t)
+	p := &proxy.Proxy{Address: listener.Addr().String(), Type: proxy.HTTPS, TLS: &proxy.TLSOptions{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := dialProxy(ctx, p)
+	if err == nil {
+		t.Fatal("expected the stalled TLS handshake to fail")
+	}
+	if kind := Classify(err); kind != ErrTimeout {
+		t.Errorf("classified %q as %s, want timeout", err, kind)
+	}
+}
+
+func TestClassifyDialProxyRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = dialProxy(context.Background(), &proxy.Proxy{Address: addr, Type: proxy.SOCKS5})
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("got %v, want a wrapped ECONNREFUSED", err)
+	}
+	if kind := Classify(err); kind != ErrRefused {
+		t.Errorf("classified %q as %s, want refused", err, kind)
+	}
+}
@@ -0,0 +1,141 @@
+package hosts
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+type RuleAction int
+
+const (
+	RuleProxy RuleAction = iota
+	RuleDirect
+	RuleReject
+)
+
+func (a RuleAction) String() string {
+	switch a {
+	case RuleProxy:
+		return "proxy"
+	case RuleDirect:
+		return "direct"
+	case RuleReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+type Rule struct {
+	Pattern string
+	Action  RuleAction
+	Group   string
+	hits    int64
+}
+
+func (r *Rule) String() string {
+	if r.Group != "" {
+		return r.Pattern + " group:" + r.Group
+	}
+	return r.Pattern + " " + r.Action.String()
+}
+
+type RuleHit struct {
+	Rule string
+	Hits int64
+}
+
+func LoadRules(path string) ([]*Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []*Rule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, n, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+func ParseRule(line string) (*Rule, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("expected \"pattern action\", got %q", line)
+	}
+
+	pattern := normalizeName(fields[0])
+	if pattern != "*" && strings.Contains(strings.TrimPrefix(pattern, "*."), "*") {
+		return nil, fmt.Errorf("invalid pattern %q", fields[0])
+	}
+
+	rule := &Rule{Pattern: pattern}
+	action := strings.ToLower(fields[1])
+	switch {
+	case action == "proxy":
+		rule.Action = RuleProxy
+	case action == "direct":
+		rule.Action = RuleDirect
+	case action == "reject":
+		rule.Action = RuleReject
+	case strings.HasPrefix(action, "group:") && len(action) > len("group:"):
+		rule.Action = RuleProxy
+		rule.Group = strings.TrimPrefix(action, "group:")
+	default:
+		return nil, fmt.Errorf("unknown action %q", fields[1])
+	}
+	return rule, nil
+}
+
+func (i *Interceptor) SetRules(rules []*Rule) {
+	i.mu.Lock()
+	i.rules = rules
+	i.mu.Unlock()
+}
+
+func (i *Interceptor) matchRule(serverName string) *Rule {
+	rule := i.findRule(serverName)
+	if rule != nil {
+		atomic.AddInt64(&rule.hits, 1)
+	}
+	return rule
+}
+
+func (i *Interceptor) findRule(serverName string) *Rule {
+	i.mu.RLock()
+	rules := i.rules
+	i.mu.RUnlock()
+
+	name := normalizeName(serverName)
+	for _, rule := range rules {
+		if matchPattern(rule.Pattern, name) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (i *Interceptor) RuleHits() []RuleHit {
+	i.mu.RLock()
+	rules := i.rules
+	i.mu.RUnlock()
+
+	hits := make([]RuleHit, 0, len(rules))
+	for _, rule := range rules {
+		hits = append(hits, RuleHit{Rule: rule.String(), Hits: atomic.LoadInt64(&rule.hits)})
+	}
+	return hits
+}
@@ -0,0 +1,117 @@
+package hosts
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"daxwalkerfix/internal/proxy"
+)
+
+var Strategies = []string{"random", "roundrobin", "leastconn", "weighted", "latency"}
+
+type Candidate struct {
+	Proxy *proxy.Proxy
+	Stats Stats
+}
+
+type Selector interface {
+	Select(candidates []Candidate) *proxy.Proxy
+}
+
+func NewSelector(strategy string) (Selector, error) {
+	switch strategy {
+	case "random", "":
+		return RandomSelector{}, nil
+	case "roundrobin":
+		return &RoundRobinSelector{}, nil
+	case "leastconn":
+		return LeastConnSelector{}, nil
+	case "weighted":
+		return WeightedSelector{}, nil
+	case "latency":
+		return LatencySelector{}, nil
+	default:
+		return nil, fmt.Errorf("unknown selection strategy %q", strategy)
+	}
+}
+
+type RandomSelector struct{}
+
+func (RandomSelector) Select(candidates []Candidate) *proxy.Proxy {
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[rand.Intn(len(candidates))].Proxy
+}
+
+type RoundRobinSelector struct {
+	next uint64
+}
+
+func (s *RoundRobinSelector) Select(candidates []Candidate) *proxy.Proxy {
+	if len(candidates) == 0 {
+		return nil
+	}
+	n := atomic.AddUint64(&s.next, 1) - 1
+	return candidates[n%uint64(len(candidates))].Proxy
+}
+
+type LeastConnSelector struct{}
+
+func (LeastConnSelector) Select(candidates []Candidate) *proxy.Proxy {
+	return pickLowest(candidates, func(a, b Stats) bool {
+		if a.Active != b.Active {
+			return a.Active < b.Active
+		}
+		return a.Failures < b.Failures
+	})
+}
+
+type WeightedSelector struct{}
+
+func (WeightedSelector) Select(candidates []Candidate) *proxy.Proxy {
+	total := 0
+	for _, c := range candidates {
+		total += c.Proxy.EffectiveWeight()
+	}
+	if total == 0 {
+		return nil
+	}
+
+	n := rand.Intn(total)
+	for _, c := range candidates {
+		n -= c.Proxy.EffectiveWeight()
+		if n < 0 {
+			return c.Proxy
+		}
+	}
+	return candidates[len(candidates)-1].Proxy
+}
+
+type LatencySelector struct{}
+
+func (LatencySelector) Select(candidates []Candidate) *proxy.Proxy {
+	return pickLowest(candidates, func(a, b Stats) bool {
+		if a.Failures != b.Failures {
+			return a.Failures < b.Failures
+		}
+		return a.Latency < b.Latency
+	})
+}
+
+func pickLowest(candidates []Candidate, less func(a, b Stats) bool) *proxy.Proxy {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	offset := rand.Intn(len(candidates))
+	best := candidates[offset]
+	for n := 1; n < len(candidates); n++ {
+		c := candidates[(offset+n)%len(candidates)]
+		if less(c.Stats, best.Stats) {
+			best = c
+		}
+	}
+	return best.Proxy
+}
@@ -0,0 +1,165 @@
+package hosts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	recordTypeHandshake    = 0x16
+	handshakeClientHello   = 0x01
+	extensionServerName    = 0x0000
+	maxClientHelloSize     = 64 * 1024
+	clientHelloReadTimeout = 5 * time.Second
+)
+
+var (
+	errNotClientHello      = errors.New("not a TLS ClientHello")
+	errClientHelloTooLarge = errors.New("ClientHello too large")
+)
+
+func peekServerName(conn net.Conn) (string, net.Conn, error) {
+	var replay bytes.Buffer
+	conn.SetReadDeadline(time.Now().Add(clientHelloReadTimeout))
+	hello, err := readClientHello(io.TeeReader(conn, &replay))
+	conn.SetReadDeadline(time.Time{})
+
+	peeked := &bufferedConn{Conn: conn, reader: io.MultiReader(&replay, conn)}
+	if err != nil {
+		return "", peeked, err
+	}
+
+	name, err := parseServerName(hello)
+	return name, peeked, err
+}
+
+func readClientHello(r io.Reader) ([]byte, error) {
+	var message []byte
+	for {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		if header[0] != recordTypeHandshake {
+			return nil, errNotClientHello
+		}
+
+		length := int(binary.BigEndian.Uint16(header[3:5]))
+		if len(message)+length > maxClientHelloSize {
+			return nil, errClientHelloTooLarge
+		}
+		record := make([]byte, length)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, err
+		}
+		message = append(message, record...)
+
+		if len(message) >= 4 {
+			if message[0] != handshakeClientHello {
+				return nil, errNotClientHello
+			}
+			size := int(message[1])<<16 | int(message[2])<<8 | int(message[3])
+			if len(message) >= 4+size {
+				return message[4 : 4+size], nil
+			}
+		}
+	}
+}
+
+func parseServerName(hello []byte) (string, error) {
+	s := helloReader(hello)
+	if !s.skip(2+32) || !s.skipVector(1) || !s.skipVector(2) || !s.skipVector(1) {
+		return "", errors.New("malformed ClientHello")
+	}
+	if s.empty() {
+		return "", nil
+	}
+
+	extensions, ok := s.vector(2)
+	if !ok {
+		return "", errors.New("malformed ClientHello extensions")
+	}
+	for !extensions.empty() {
+		extType, ok1 := extensions.readUint16()
+		data, ok2 := extensions.vector(2)
+		if !ok1 || !ok2 {
+			return "", errors.New("malformed ClientHello extensions")
+		}
+		if extType != extensionServerName {
+			continue
+		}
+
+		names, ok := data.vector(2)
+		if !ok {
+			return "", errors.New("malformed server_name extension")
+		}
+		for !names.empty() {
+			nameType, ok1 := names.readUint8()
+			name, ok2 := names.vector(2)
+			if !ok1 || !ok2 {
+				return "", errors.New("malformed server_name extension")
+			}
+			if nameType == 0 {
+				return string(name), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+type helloReader []byte
+
+func (s *helloReader) empty() bool {
+	return len(*s) == 0
+}
+
+func (s *helloReader) skip(n int) bool {
+	if len(*s) < n {
+		return false
+	}
+	*s = (*s)[n:]
+	return true
+}
+
+func (s *helloReader) readUint8() (int, bool) {
+	if len(*s) < 1 {
+		return 0, false
+	}
+	v := int((*s)[0])
+	*s = (*s)[1:]
+	return v, true
+}
+
+func (s *helloReader) readUint16() (int, bool) {
+	if len(*s) < 2 {
+		return 0, false
+	}
+	v := int(binary.BigEndian.Uint16(*s))
+	*s = (*s)[2:]
+	return v, true
+}
+
+func (s *helloReader) vector(lengthBytes int) (helloReader, bool) {
+	var n int
+	var ok bool
+	if lengthBytes == 1 {
+		n, ok = s.readUint8()
+	} else {
+		n, ok = s.readUint16()
+	}
+	if !ok || len(*s) < n {
+		return nil, false
+	}
+	v := (*s)[:n]
+	*s = (*s)[n:]
+	return v, true
+}
+
+func (s *helloReader) skipVector(lengthBytes int) bool {
+	_, ok := s.vector(lengthBytes)
+	return ok
+}
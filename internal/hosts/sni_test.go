@@ -0,0 +1,155 @@
+package hosts
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func clientHelloRecords(t *testing.T, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		defer client.Close()
+		tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+	}()
+
+	var raw bytes.Buffer
+	if _, err := readClientHello(io.TeeReader(server, &raw)); err != nil {
+		t.Fatal(err)
+	}
+	return raw.Bytes()
+}
+
+func splitRecord(records []byte, at int) []byte {
+	body := records[5:]
+	var out []byte
+	for _, part := range [][]byte{body[:at], body[at:]} {
+		header := []byte{recordTypeHandshake, records[1], records[2], 0, 0}
+		binary.BigEndian.PutUint16(header[3:], uint16(len(part)))
+		out = append(out, header...)
+		out = append(out, part...)
+	}
+	return out
+}
+
+func TestPeekServerName(t *testing.T) {
+	records := clientHelloRecords(t, "walker.dax.cloud")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"single record", records},
+		{"fragmented header", splitRecord(records, 2)},
+		{"fragmented body", splitRecord(records, 40)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			go client.Write(append(tt.data, "rest"...))
+
+			name, peeked, err := peekServerName(server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != "walker.dax.cloud" {
+				t.Errorf("got server name %q", name)
+			}
+
+			replay := make([]byte, len(tt.data)+4)
+			if _, err := io.ReadFull(peeked, replay); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(replay, append(tt.data, "rest"...)) {
+				t.Error("peeked connection does not replay the ClientHello")
+			}
+		})
+	}
+}
+
+func TestParseServerNameWithoutSNI(t *testing.T) {
+	records := clientHelloRecords(t, "")
+	hello, err := readClientHello(bytes.NewReader(records))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := parseServerName(hello)
+	if err != nil || name != "" {
+		t.Errorf("got %q, %v, want no name", name, err)
+	}
+}
+
+func TestReadClientHelloRejectsGarbage(t *testing.T) {
+	records := clientHelloRecords(t, "walker.dax.cloud")
+	header := []byte{recordTypeHandshake, 3, 1, 0xff, 0xff}
+	oversized := append(append([]byte(nil), header...), handshakeClientHello, 0xff, 0xff, 0xff)
+	oversized = append(oversized, make([]byte, 0xffff-4)...)
+	oversized = append(oversized, header...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, io.EOF},
+		{"plain HTTP", []byte("GET / HTTP/1.1\r\nHost: walker.dax.cloud\r\n\r\n"), errNotClientHello},
+		{"alert record", []byte{0x15, 3, 1, 0, 2, 2, 40}, errNotClientHello},
+		{"not a ClientHello", []byte{recordTypeHandshake, 3, 1, 0, 4, 2, 0, 0, 0}, errNotClientHello},
+		{"truncated header", records[:3], io.ErrUnexpectedEOF},
+		{"truncated record", records[:len(records)-10], io.ErrUnexpectedEOF},
+		{"truncated message", splitRecord(records, 40)[:5+40], io.EOF},
+		{"oversized", oversized, errClientHelloTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readClientHello(bytes.NewReader(tt.data))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseServerNameTruncated(t *testing.T) {
+	records := clientHelloRecords(t, "walker.dax.cloud")
+	hello, err := readClientHello(bytes.NewReader(records))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < len(hello); n++ {
+		name, err := parseServerName(hello[:n])
+		if err == nil && name == "walker.dax.cloud" {
+			t.Fatalf("parsed the server name from %d of %d bytes", n, len(hello))
+		}
+	}
+}
+
+func TestParseServerNameCorrupted(t *testing.T) {
+	records := clientHelloRecords(t, "walker.dax.cloud")
+	hello, err := readClientHello(bytes.NewReader(records))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := range hello {
+		for _, b := range []byte{0x00, 0x7f, 0xff} {
+			corrupted := append([]byte(nil), hello...)
+			corrupted[n] = b
+			parseServerName(corrupted)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package hosts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"daxwalkerfix/internal/proxy"
+)
+
+const handshakeTimeout = 5 * time.Second
+
+var socks4Errors = map[byte]string{
+	91: "request rejected or failed",
+	92: "proxy could not reach identd on the client",
+	93: "identd reported a different user ID",
+}
+
+func (i *Interceptor) connectViaSocks4(conn net.Conn, addr string, p *proxy.Proxy) (net.Conn, error) {
+	req, err := i.socks4Request(addr, p)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send SOCKS4 request: %w", err)
+	}
+
+	resp := make([]byte, 8)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read SOCKS4 response: %w", err)
+	}
+
+	if resp[1] != 90 {
+		conn.Close()
+		if msg, ok := socks4Errors[resp[1]]; ok {
+			return nil, fmt.Errorf("SOCKS4 connect failed: %s", msg)
+		}
+		return nil, fmt.Errorf("SOCKS4 connect failed: reply code %d", resp[1])
+	}
+
+	return conn, nil
+}
+
+func (i *Interceptor) socks4Request(addr string, p *proxy.Proxy) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	var hostname string
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		if p.Type == proxy.SOCKS4A {
+			ip = net.IPv4(0, 0, 0, 1).To4()
+			hostname = host
+		} else {
+			ip, err = i.resolveIPv4(host)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	req := []byte{4, 1, byte(port >> 8), byte(port)}
+	req = append(req, ip...)
+	if p.Auth != nil {
+		req = append(req, p.Auth.Username()...)
+	}
+	req = append(req, 0)
+	if hostname != "" {
+		req = append(req, hostname...)
+		req = append(req, 0)
+	}
+
+	return req, nil
+}
+
+func (i *Interceptor) resolveIPv4(host string) (net.IP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	i.mu.RLock()
+	r := i.resolver
+	i.mu.RUnlock()
+
+	ip, err := r.LookupIPv4(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if ip.IsLoopback() {
+		return nil, fmt.Errorf("%s resolves to %s, use a SOCKS4a proxy instead", host, ip)
+	}
+	return ip, nil
+}
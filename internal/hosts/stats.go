@@ -0,0 +1,163 @@
+package hosts
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"daxwalkerfix/internal/bandwidth"
+	"daxwalkerfix/internal/proxy"
+)
+
+const (
+	failureWindow = 5 * time.Minute
+	latencyWeight = 0.3
+	retiredConns  = -1 << 62
+)
+
+type Stats struct {
+	Active   int64
+	Conns    int64
+	Failures int
+	Latency  time.Duration
+	Breaker  BreakerState
+}
+
+type proxyStats struct {
+	active   int64
+	conns    int64
+	upload   *bandwidth.Limiter
+	download *bandwidth.Limiter
+
+	mu          sync.Mutex
+	failures    int
+	lastFailure time.Time
+	latency     time.Duration
+	breaker     breaker
+}
+
+func (s *proxyStats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures := s.failures
+	if time.Since(s.lastFailure) > failureWindow {
+		failures = 0
+	}
+	return Stats{
+		Active:   atomic.LoadInt64(&s.active),
+		Conns:    atomic.LoadInt64(&s.conns),
+		Failures: failures,
+		Latency:  s.latency,
+		Breaker:  s.breaker.state,
+	}
+}
+
+func (s *proxyStats) available() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.breaker.available()
+}
+
+func (s *proxyStats) claim() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.breaker.claim()
+}
+
+func (s *proxyStats) releaseClaim() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breaker.release()
+}
+
+func (s *proxyStats) saturated(max int) bool {
+	return max > 0 && atomic.LoadInt64(&s.conns) >= int64(max)
+}
+
+func (s *proxyStats) acquire(max int) bool {
+	for {
+		conns := atomic.LoadInt64(&s.conns)
+		if conns < 0 || max > 0 && conns >= int64(max) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&s.conns, conns, conns+1) {
+			return true
+		}
+	}
+}
+
+func (s *proxyStats) releaseSlot() {
+	atomic.AddInt64(&s.conns, -1)
+}
+
+func (s *proxyStats) retire() bool {
+	return atomic.CompareAndSwapInt64(&s.conns, 0, retiredConns)
+}
+
+func (s *proxyStats) recordSuccess(latency time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = 0
+	s.observeLatency(latency)
+	return s.breaker.success()
+}
+
+func (s *proxyStats) recordSlow(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elapsed > s.latency {
+		s.observeLatency(elapsed)
+	}
+	s.breaker.release()
+}
+
+func (s *proxyStats) observeLatency(latency time.Duration) {
+	if s.latency == 0 {
+		s.latency = latency
+		return
+	}
+	s.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(s.latency))
+}
+
+func (s *proxyStats) recordFailure() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastFailure) > failureWindow {
+		s.failures = 0
+	}
+	s.failures++
+	s.lastFailure = time.Now()
+	return s.breaker.failure()
+}
+
+func (i *Interceptor) statsFor(p *proxy.Proxy) *proxyStats {
+	i.statsMu.Lock()
+	defer i.statsMu.Unlock()
+
+	s, ok := i.stats[p]
+	if !ok {
+		s = &proxyStats{
+			upload:   bandwidth.NewLimiter(proxyLimit(p.UploadLimit, &bandwidth.PerProxy.Upload)),
+			download: bandwidth.NewLimiter(proxyLimit(p.DownloadLimit, &bandwidth.PerProxy.Download)),
+		}
+		i.stats[p] = s
+	}
+	return s
+}
+
+func proxyLimit(own int64, fallback *bandwidth.Limit) func() int64 {
+	return func() int64 {
+		if own > 0 {
+			return own
+		}
+		return fallback.Get()
+	}
+}
+
+func (i *Interceptor) ProxyStats(p *proxy.Proxy) Stats {
+	return i.statsFor(p).snapshot()
+}
@@ -0,0 +1,141 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"daxwalkerfix/internal/output"
+	"daxwalkerfix/internal/proxy"
+)
+
+var StickyModes = []string{"off", "ip", "process"}
+
+type session struct {
+	proxy   *proxy.Proxy
+	expires time.Time
+}
+
+type SessionInfo struct {
+	Key     string
+	Proxy   *proxy.Proxy
+	Expires time.Time
+}
+
+func (i *Interceptor) SetSticky(mode string, ttl time.Duration) error {
+	switch mode {
+	case "off", "ip", "process":
+	default:
+		return fmt.Errorf("unknown sticky mode %q", mode)
+	}
+	if mode != "off" && ttl <= 0 {
+		return fmt.Errorf("sticky TTL must be positive")
+	}
+
+	i.sessionMu.Lock()
+	i.stickyMode = mode
+	i.stickyTTL = ttl
+	i.sessions = make(map[string]*session)
+	i.sessionMu.Unlock()
+	return nil
+}
+
+func (i *Interceptor) sessionKey(client net.Conn) string {
+	i.sessionMu.Lock()
+	mode := i.stickyMode
+	i.sessionMu.Unlock()
+
+	switch mode {
+	case "process":
+		pid, err := processID(client.RemoteAddr(), client.LocalAddr())
+		if err == nil {
+			return fmt.Sprintf("pid %d", pid)
+		}
+		output.Warn("Sticky session falling back to client IP: %v", err)
+		fallthrough
+	case "ip":
+		host, _, err := net.SplitHostPort(client.RemoteAddr().String())
+		if err != nil {
+			return ""
+		}
+		return "ip " + host
+	default:
+		return ""
+	}
+}
+
+func (i *Interceptor) sessionProxy(key string) *proxy.Proxy {
+	if key == "" {
+		return nil
+	}
+
+	i.sessionMu.Lock()
+	s, ok := i.sessions[key]
+	if ok && time.Now().After(s.expires) {
+		delete(i.sessions, key)
+		ok = false
+	}
+	i.sessionMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, p := range i.proxies {
+		if p != s.proxy {
+			continue
+		}
+		if ok, _ := i.reserve(p); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+func (i *Interceptor) pinSession(key string, p *proxy.Proxy) {
+	if key == "" || p == nil {
+		return
+	}
+
+	i.sessionMu.Lock()
+	defer i.sessionMu.Unlock()
+	if s, ok := i.sessions[key]; ok && s.proxy == p {
+		return
+	}
+	i.sessions[key] = &session{proxy: p, expires: time.Now().Add(i.stickyTTL)}
+	output.Info("Sticky session %s pinned to %s", key, p.Label())
+}
+
+func (i *Interceptor) dropSession(key string, p *proxy.Proxy) {
+	if key == "" {
+		return
+	}
+
+	i.sessionMu.Lock()
+	defer i.sessionMu.Unlock()
+	if s, ok := i.sessions[key]; ok && s.proxy == p {
+		delete(i.sessions, key)
+		output.Info("Sticky session %s dropped %s after an error", key, p.Label())
+	}
+}
+
+func (i *Interceptor) Sessions() []SessionInfo {
+	i.sessionMu.Lock()
+	defer i.sessionMu.Unlock()
+
+	var sessions []SessionInfo
+	now := time.Now()
+	for key, s := range i.sessions {
+		if now.After(s.expires) {
+			delete(i.sessions, key)
+			continue
+		}
+		sessions = append(sessions, SessionInfo{Key: key, Proxy: s.proxy, Expires: s.expires})
+	}
+	sort.Slice(sessions, func(a, b int) bool {
+		return sessions[a].Key < sessions[b].Key
+	})
+	return sessions
+}
@@ -0,0 +1,60 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+
+	"daxwalkerfix/internal/proxy"
+)
+
+func dialProxy(ctx context.Context, p *proxy.Proxy) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	if p.TLS == nil {
+		return conn, nil
+	}
+	return wrapTLS(ctx, conn, p)
+}
+
+func wrapTLS(ctx context.Context, conn net.Conn, p *proxy.Proxy) (net.Conn, error) {
+	serverName := p.TLS.ServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(p.Address)
+	}
+
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: p.TLS.SkipVerify || p.TLS.Pin != nil,
+	}
+	if p.TLS.Pin != nil {
+		pin := p.TLS.Pin
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("proxy sent no certificate")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(sum[:], pin) {
+				return fmt.Errorf("proxy certificate fingerprint %x does not match pin", sum)
+			}
+			return nil
+		}
+	}
+
+	tlsConn := tls.Client(conn, config)
+	tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with proxy failed: %w", err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
@@ -0,0 +1,183 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"daxwalkerfix/internal/output"
+)
+
+const (
+	probeSuffix     = ".probe.daxwalkerfix.invalid"
+	probeReply      = "daxwalkerfix-probe "
+	verifyTimeout   = 5 * time.Second
+	verifyStartWait = 200 * time.Millisecond
+	verifyInterval  = 30 * time.Second
+)
+
+func (i *Interceptor) SetupProblems() []error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return append([]error(nil), i.setupProblems...)
+}
+
+func (i *Interceptor) verifySetup(ctx context.Context, redirect Redirector) {
+	defer output.Recover("setup verification")
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(verifyStartWait):
+	}
+
+	ticker := time.NewTicker(verifyInterval)
+	defer ticker.Stop()
+
+	reported := "unchecked"
+	for {
+		problems := i.checkSetup(ctx, redirect)
+		if ctx.Err() != nil {
+			return
+		}
+		i.mu.Lock()
+		i.setupProblems = problems
+		i.mu.Unlock()
+
+		var summary []string
+		for _, err := range problems {
+			summary = append(summary, err.Error())
+		}
+		if current := strings.Join(summary, "\n"); current != reported {
+			reported = current
+			if len(problems) == 0 {
+				output.Info("Setup verified: our domains reach this app")
+			}
+			for _, err := range problems {
+				fmt.Printf("[%s] WARNING: %v\n", time.Now().Format("15:04:05"), err)
+				output.Warn("Setup check failed: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-i.setupRecheck:
+		}
+	}
+}
+
+func (i *Interceptor) recheckSetup() {
+	select {
+	case i.setupRecheck <- struct{}{}:
+	default:
+	}
+}
+
+func (i *Interceptor) checkSetup(ctx context.Context, redirect Redirector) []error {
+	if _, ok := redirect.(noneRedirect); ok {
+		if err := probeListener(ctx, listenAddr); err != nil {
+			return []error{err}
+		}
+		return nil
+	}
+
+	listenIP, _, _ := net.SplitHostPort(listenAddr)
+	var problems []error
+	for _, d := range i.Domains() {
+		if strings.HasPrefix(d.Name, "*.") {
+			continue
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, verifyTimeout)
+		addrs, err := net.DefaultResolver.LookupHost(lookupCtx, d.Name)
+		cancel()
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s does not resolve (%v). %s", d.Name, err, redirectHint(redirect)))
+			continue
+		}
+		if !containsAddr(addrs, listenIP) {
+			problems = append(problems, fmt.Errorf("%s resolves to %s instead of %s. %s", d.Name, strings.Join(addrs, ", "), listenIP, redirectHint(redirect)))
+			continue
+		}
+		if err := probeListener(ctx, net.JoinHostPort(listenIP, "443")); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", d.Name, err))
+		}
+	}
+	return problems
+}
+
+func redirectHint(redirect Redirector) string {
+	switch r := redirect.(type) {
+	case *hostsRedirect:
+		return fmt.Sprintf("Windows may still have the old answer cached, run \"ipconfig /flushdns\" and restart the client. "+
+			"Also check that %s isn't being reset by antivirus and that the client doesn't use its own DNS (Secure DNS / DNS over HTTPS).", r.file.Path)
+	case *dnsRedirect:
+		return fmt.Sprintf("Set the DNS server of your network adapter or client to %s, then run \"ipconfig /flushdns\".", r.addr)
+	}
+	return ""
+}
+
+func containsAddr(addrs []string, ip string) bool {
+	for _, addr := range addrs {
+		if addr == ip {
+			return true
+		}
+	}
+	return false
+}
+
+type recordingConn struct {
+	net.Conn
+	read bytes.Buffer
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Write(b[:n])
+	return n, err
+}
+
+func probeListener(ctx context.Context, addr string) error {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	token := hex.EncodeToString(nonce)
+
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not connect to %s (%v). A firewall or security tool may be blocking local connections", addr, err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	recorder := &recordingConn{Conn: conn}
+	tls.Client(recorder, &tls.Config{ServerName: token + probeSuffix, InsecureSkipVerify: true}).Handshake()
+	reply, _ := io.ReadAll(io.MultiReader(&recorder.read, conn))
+
+	if !bytes.Equal(reply, []byte(probeReply+token)) {
+		return fmt.Errorf("%s answered but it isn't this app. Another program may be handling port 443, or a proxy configured in the client or Windows is intercepting the connection", addr)
+	}
+	return nil
+}
+
+func answerProbe(serverName string, client net.Conn) bool {
+	token, ok := strings.CutSuffix(serverName, probeSuffix)
+	if !ok {
+		return false
+	}
+	client.Write([]byte(probeReply + token))
+	return true
+}
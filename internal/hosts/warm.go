@@ -0,0 +1,204 @@
+package hosts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"daxwalkerfix/internal/output"
+	"daxwalkerfix/internal/proxy"
+)
+
+const (
+	DefaultWarmIdle  = 30 * time.Second
+	warmRefillPeriod = time.Second
+	warmProbeTimeout = time.Millisecond
+)
+
+type warmKey struct {
+	proxy *proxy.Proxy
+	addr  string
+}
+
+type warmTunnel struct {
+	conn  net.Conn
+	since time.Time
+}
+
+type warmPool struct {
+	mu      sync.Mutex
+	size    int
+	maxIdle time.Duration
+	idle    map[warmKey][]*warmTunnel
+	pending map[warmKey]int
+}
+
+func (i *Interceptor) SetWarmPool(size int, maxIdle time.Duration) {
+	i.warm.mu.Lock()
+	i.warm.size = size
+	i.warm.maxIdle = maxIdle
+	i.warm.mu.Unlock()
+}
+
+func (i *Interceptor) WarmTunnels() int {
+	i.warm.mu.Lock()
+	defer i.warm.mu.Unlock()
+
+	n := 0
+	for _, tunnels := range i.warm.idle {
+		n += len(tunnels)
+	}
+	return n
+}
+
+func (i *Interceptor) runWarmPool(ctx context.Context) {
+	defer output.Recover("warm pool")
+	i.warm.mu.Lock()
+	i.warm.idle = make(map[warmKey][]*warmTunnel)
+	i.warm.pending = make(map[warmKey]int)
+	i.warm.mu.Unlock()
+
+	ticker := time.NewTicker(warmRefillPeriod)
+	defer ticker.Stop()
+	for {
+		i.refillWarmPool(ctx)
+		select {
+		case <-ctx.Done():
+			i.drainWarmPool()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (i *Interceptor) refillWarmPool(ctx context.Context) {
+	i.mu.RLock()
+	proxies := i.proxies
+	domains := i.domains
+	timeout := i.retry.Timeout
+	i.mu.RUnlock()
+
+	wanted := make(map[warmKey]bool)
+	for _, d := range domains {
+		if d.Upstream == "" {
+			continue
+		}
+		rule := i.findRule(d.Name)
+		if rule != nil && rule.Action != RuleProxy {
+			continue
+		}
+		for _, p := range proxies {
+			if rule == nil || rule.Group == "" || rule.Group == p.Group {
+				wanted[warmKey{proxy: p, addr: d.Upstream}] = true
+			}
+		}
+	}
+
+	i.warm.mu.Lock()
+	defer i.warm.mu.Unlock()
+
+	for key, tunnels := range i.warm.idle {
+		var kept []*warmTunnel
+		for _, t := range tunnels {
+			if !wanted[key] || time.Since(t.since) > i.warm.maxIdle {
+				t.conn.Close()
+				continue
+			}
+			kept = append(kept, t)
+		}
+		if len(kept) == 0 {
+			delete(i.warm.idle, key)
+		} else {
+			i.warm.idle[key] = kept
+		}
+	}
+
+	for key := range wanted {
+		stats := i.statsFor(key.proxy)
+		for n := len(i.warm.idle[key]) + i.warm.pending[key]; n < i.warm.size; n++ {
+			if !stats.available() || !stats.acquire(key.proxy.MaxConns) {
+				break
+			}
+			i.warm.pending[key]++
+			go i.openWarmTunnel(ctx, key, timeout)
+		}
+	}
+}
+
+func (i *Interceptor) openWarmTunnel(ctx context.Context, key warmKey, timeout time.Duration) {
+	defer output.Recover("warm tunnel")
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	conn, err := i.dial(dialCtx, key.addr, key.proxy)
+	cancel()
+
+	i.warm.mu.Lock()
+	defer i.warm.mu.Unlock()
+	i.warm.pending[key]--
+	if err != nil {
+		output.Info("Warm tunnel to %s via %s failed: %v", key.addr, key.proxy.Label(), err)
+		return
+	}
+	if ctx.Err() != nil {
+		conn.Close()
+		return
+	}
+	i.warm.idle[key] = append(i.warm.idle[key], &warmTunnel{conn: conn, since: time.Now()})
+}
+
+func (i *Interceptor) takeWarm(proxies []*proxy.Proxy, addr string) (net.Conn, *proxy.Proxy) {
+	for _, p := range proxies {
+		if p == nil {
+			continue
+		}
+		conn := i.popWarm(warmKey{proxy: p, addr: addr})
+		if conn == nil {
+			continue
+		}
+		for _, reserved := range proxies {
+			i.statsFor(reserved).releaseClaim()
+			i.releaseProxySlot(reserved)
+		}
+		return conn, p
+	}
+	return nil, nil
+}
+
+func (i *Interceptor) popWarm(key warmKey) net.Conn {
+	i.warm.mu.Lock()
+	defer i.warm.mu.Unlock()
+
+	for len(i.warm.idle[key]) > 0 {
+		tunnels := i.warm.idle[key]
+		t := tunnels[len(tunnels)-1]
+		i.warm.idle[key] = tunnels[:len(tunnels)-1]
+
+		if time.Since(t.since) <= i.warm.maxIdle && tunnelAlive(t.conn) {
+			return t.conn
+		}
+		t.conn.Close()
+	}
+	return nil
+}
+
+func tunnelAlive(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(warmProbeTimeout))
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	conn.SetReadDeadline(time.Time{})
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func (i *Interceptor) drainWarmPool() {
+	i.warm.mu.Lock()
+	defer i.warm.mu.Unlock()
+
+	for key, tunnels := range i.warm.idle {
+		for _, t := range tunnels {
+			t.conn.Close()
+		}
+		delete(i.warm.idle, key)
+	}
+}
@@ -0,0 +1,141 @@
+package hosts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"daxwalkerfix/internal/output"
+)
+
+const DefaultWatchInterval = 15 * time.Second
+
+var errHostsPaused = errors.New("serving paused until the hosts entry is restored")
+
+type HostsWatchStatus struct {
+	Tampered   int
+	LastTamper time.Time
+	Missing    []string
+	Paused     bool
+}
+
+type hostsWatch struct {
+	mu       sync.Mutex
+	interval time.Duration
+	strict   bool
+	status   HostsWatchStatus
+}
+
+func (i *Interceptor) SetHostsWatch(interval time.Duration, strict bool) {
+	i.watch.mu.Lock()
+	i.watch.interval = interval
+	i.watch.strict = strict
+	i.watch.mu.Unlock()
+}
+
+func (i *Interceptor) HostsWatch() HostsWatchStatus {
+	i.watch.mu.Lock()
+	defer i.watch.mu.Unlock()
+
+	status := i.watch.status
+	status.Missing = append([]string(nil), status.Missing...)
+	return status
+}
+
+func (i *Interceptor) watchPaused() bool {
+	i.watch.mu.Lock()
+	defer i.watch.mu.Unlock()
+	return i.watch.status.Paused
+}
+
+func (i *Interceptor) runHostsWatch(ctx context.Context, h *hostsRedirect) {
+	defer output.Recover("hosts watchdog")
+
+	i.watch.mu.Lock()
+	interval := i.watch.interval
+	i.watch.mu.Unlock()
+	if interval <= 0 || len(h.names) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.checkHostsEntries(h)
+		}
+	}
+}
+
+func (i *Interceptor) checkHostsEntries(h *hostsRedirect) {
+	ip, _, _ := net.SplitHostPort(listenAddr)
+	missing, err := h.file.Missing(h.names, ip)
+	if err != nil {
+		output.Warn("Hosts watchdog could not read %s: %v", h.file.Path, err)
+		return
+	}
+
+	i.watch.mu.Lock()
+	strict := i.watch.strict
+	wasMissing := len(i.watch.status.Missing) > 0
+	i.watch.mu.Unlock()
+
+	if len(missing) == 0 {
+		if wasMissing {
+			i.setWatchStatus(nil, false, false)
+			i.recheckSetup()
+			fmt.Printf("[%s] Hosts entry restored\n", time.Now().Format("15:04:05"))
+			output.Info("Hosts entries for %s are back in place", strings.Join(h.names, ", "))
+		}
+		return
+	}
+
+	if !wasMissing {
+		when := "at an unknown time"
+		if info, err := os.Stat(h.file.Path); err == nil {
+			when = "at " + info.ModTime().Format(time.DateTime)
+		}
+		fmt.Printf("[%s] WARNING: hosts entry for %s was removed, restoring\n", time.Now().Format("15:04:05"), strings.Join(missing, ", "))
+		output.Warn("Hosts entry for %s was removed from %s %s, likely by antivirus or another tool", strings.Join(missing, ", "), h.file.Path, when)
+	}
+
+	if err := h.file.AddEntries(missing, ip); err != nil {
+		i.setWatchStatus(missing, !wasMissing, strict)
+		if wasMissing {
+			return
+		}
+		if strict {
+			closed := i.closeLive()
+			output.Error("Failed to restore hosts entry: %v, serving paused and %d connections closed", err, closed)
+		} else {
+			output.Error("Failed to restore hosts entry: %v, traffic for %s may go direct", err, strings.Join(missing, ", "))
+		}
+		return
+	}
+
+	i.setWatchStatus(nil, !wasMissing, false)
+	i.recheckSetup()
+	fmt.Printf("[%s] Hosts entry restored\n", time.Now().Format("15:04:05"))
+	output.Info("Restored hosts entry for %s", strings.Join(missing, ", "))
+}
+
+func (i *Interceptor) setWatchStatus(missing []string, tampered, paused bool) {
+	i.watch.mu.Lock()
+	defer i.watch.mu.Unlock()
+
+	if tampered {
+		i.watch.status.Tampered++
+		i.watch.status.LastTamper = time.Now()
+	}
+	i.watch.status.Missing = missing
+	i.watch.status.Paused = paused
+}
@@ -3,11 +3,9 @@ package idleexit
 import (
 	"context"
 	"fmt"
-	"os"
 	"sync"
 	"time"
 
-	"daxwalkerfix/internal/bandwidth"
 	"daxwalkerfix/internal/output"
 )
 
@@ -32,6 +30,7 @@ func Start(ctx context.Context, limit time.Duration, cancelFunc context.CancelFu
 	}
 
 	go func() {
+		defer output.Recover("idle timer")
 		ticker := time.NewTicker(30 * time.Second)
 		defer ticker.Stop()
 
@@ -44,11 +43,10 @@ func Start(ctx context.Context, limit time.Duration, cancelFunc context.CancelFu
 				since := time.Since(lastActivity)
 				if timeout > 0 && since >= timeout {
 					fmt.Printf("Idle timeout reached, exiting\n")
-					bandwidth.LogSession()
 					output.Info("Idle timeout reached, exiting")
 					mu.Unlock()
 					cancel()
-					os.Exit(0)
+					return
 				}
 				mu.Unlock()
 			}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package journal
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func processAlive(pid int, started time.Time) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,67 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Entry struct {
+	PID       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+	HostsFile string    `json:"hosts_file"`
+	IP        string    `json:"ip"`
+	Names     []string  `json:"names"`
+}
+
+func Path() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "Desktop", "DaxWalkerFix", "journal.json")
+}
+
+func Write(e Entry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := Path()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func Read() (*Entry, error) {
+	data, err := os.ReadFile(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func Clear() error {
+	err := os.Remove(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (e *Entry) OwnerRunning() bool {
+	return e.PID != os.Getpid() && processAlive(e.PID, e.Started)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime/debug"
 	"time"
 )
 
@@ -39,4 +40,11 @@ func Error(format string, v ...interface{}) {
 	if logFile != nil {
 		fmt.Fprintf(logFile, "[%s] [ERROR] %s\n", time.Now().Format("15:04:05"), msg)
 	}
+}
+
+func Recover(where string) {
+	if r := recover(); r != nil {
+		fmt.Printf("Recovered from a crash in %s: %v\n", where, r)
+		Error("Panic in %s: %v\n%s", where, r, debug.Stack())
+	}
 }
\ No newline at end of file
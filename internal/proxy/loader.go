@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -13,29 +12,27 @@ import (
 	"daxwalkerfix/internal/output"
 )
 
-type ProxyType int
-
 const (
-	SOCKS5 ProxyType = iota
-	HTTPS
-	
 	httpTimeout = 30 * time.Second
 	maxProxies  = 200
+
+	maxShownErrors = 20
 )
 
-type Proxy struct {
-	Address string
-	Auth    *url.Userinfo
-	Type    ProxyType
+type proxySource struct {
+	URL  string
+	Type ProxyType
 }
 
-var proxySources = []string{
-	"https://raw.githubusercontent.com/TheSpeedX/PROXY-List/master/socks5.txt",
-	"https://raw.githubusercontent.com/TheSpeedX/PROXY-List/master/http.txt",
-	"https://raw.githubusercontent.com/hookzof/socks5_list/master/proxy.txt",
-	"https://raw.githubusercontent.com/clarketm/proxy-list/master/proxy-list-raw.txt",
-	"https://api.proxyscrape.com/v2/?request=get&protocol=socks5&timeout=10000&country=all&ssl=all&anonymity=all",
-	"https://api.proxyscrape.com/v2/?request=get&protocol=http&timeout=10000&country=all&ssl=all&anonymity=all",
+var proxySources = []proxySource{
+	{"https://raw.githubusercontent.com/TheSpeedX/PROXY-List/master/socks5.txt", SOCKS5},
+	{"https://raw.githubusercontent.com/TheSpeedX/PROXY-List/master/socks4.txt", SOCKS4},
+	{"https://raw.githubusercontent.com/TheSpeedX/PROXY-List/master/http.txt", HTTP},
+	{"https://raw.githubusercontent.com/hookzof/socks5_list/master/proxy.txt", SOCKS5},
+	{"https://raw.githubusercontent.com/clarketm/proxy-list/master/proxy-list-raw.txt", HTTP},
+	{"https://api.proxyscrape.com/v2/?request=get&protocol=socks5&timeout=10000&country=all&ssl=all&anonymity=all", SOCKS5},
+	{"https://api.proxyscrape.com/v2/?request=get&protocol=socks4&timeout=10000&country=all&ssl=all&anonymity=all", SOCKS4},
+	{"https://api.proxyscrape.com/v2/?request=get&protocol=http&timeout=10000&country=all&ssl=all&anonymity=all", HTTP},
 }
 
 func Load() ([]*Proxy, bool, error) {
@@ -69,7 +66,7 @@ func Load() ([]*Proxy, bool, error) {
 		return nil, false, fmt.Errorf("failed to read proxy file: %v", err)
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	lines := SplitLines(data)
 	needsChoice := false
 
 	for _, line := range lines {
@@ -77,7 +74,7 @@ func Load() ([]*Proxy, bool, error) {
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		if !strings.HasPrefix(strings.ToLower(line), "socks5:") && !strings.HasPrefix(strings.ToLower(line), "https:") {
+		if !HasExplicitType(line) {
 			needsChoice = true
 			break
 		}
@@ -88,19 +85,27 @@ func Load() ([]*Proxy, bool, error) {
 		if rememberedType != -1 {
 			userType = ProxyType(rememberedType)
 		} else {
-			fmt.Println("Choose proxy type: 1) SOCKS5  2) HTTPS")
-			fmt.Print("Enter 1 or 2: ")
+			fmt.Println("Choose proxy type: 1) SOCKS5  2) HTTP  3) SOCKS4  4) SOCKS4a  5) HTTPS (TLS)")
+			fmt.Print("Enter 1-5: ")
 			var choice string
 			fmt.Scanln(&choice)
-			if choice == "2" {
+			switch choice {
+			case "2":
+				userType = HTTP
+			case "5":
 				userType = HTTPS
-			} else {
+			case "3":
+				userType = SOCKS4
+			case "4":
+				userType = SOCKS4A
+			default:
 				userType = SOCKS5
 			}
 		}
 	}
 
-	proxies := parseProxies(lines, userType)
+	proxies, skipped := ParseLines(lines, userType)
+	printParseSummary(proxies, skipped)
 
 	if len(proxies) == 0 {
 		return nil, false, fmt.Errorf("no proxies found")
@@ -117,57 +122,18 @@ func Load() ([]*Proxy, bool, error) {
 	return proxies, autoRemove, nil
 }
 
-func parseProxies(lines []string, defaultType ProxyType) []*Proxy {
-	var proxies []*Proxy
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		parts := strings.Split(line, ":")
-		if len(parts) < 2 {
-			continue
+func printParseSummary(proxies []*Proxy, skipped []*ParseError) {
+	fmt.Printf("Accepted %d proxies, skipped %d lines\n", len(proxies), len(skipped))
+	output.Info("Parsed proxy file: %d accepted, %d skipped", len(proxies), len(skipped))
+	for n, e := range skipped {
+		if n < maxShownErrors {
+			fmt.Printf("  %v\n", e)
 		}
-
-		var proxyType ProxyType
-		var host, port string
-		var auth *url.Userinfo
-
-		if strings.ToLower(parts[0]) == "socks5" {
-			if len(parts) < 3 {
-				continue
-			}
-			proxyType = SOCKS5
-			host, port = parts[1], parts[2]
-			if len(parts) >= 5 {
-				auth = url.UserPassword(parts[3], parts[4])
-			}
-		} else if strings.ToLower(parts[0]) == "https" {
-			if len(parts) < 3 {
-				continue
-			}
-			proxyType = HTTPS
-			host, port = parts[1], parts[2]
-			if len(parts) >= 5 {
-				auth = url.UserPassword(parts[3], parts[4])
-			}
-		} else {
-			proxyType = defaultType
-			host, port = parts[0], parts[1]
-			if len(parts) >= 4 {
-				auth = url.UserPassword(parts[2], parts[3])
-			}
-		}
-
-		p := &Proxy{
-			Address: fmt.Sprintf("%s:%s", host, port),
-			Auth:    auth,
-			Type:    proxyType,
-		}
-		proxies = append(proxies, p)
+		output.Warn("Skipped proxy %v", e)
+	}
+	if len(skipped) > maxShownErrors {
+		fmt.Printf("  ...and %d more (see daxwalkerfix.log)\n", len(skipped)-maxShownErrors)
 	}
-	return proxies
 }
 
 func loadFromInternet() ([]*Proxy, bool, error) {
@@ -175,36 +141,41 @@ func loadFromInternet() ([]*Proxy, bool, error) {
 	output.Info("Starting proxy download from sources")
 	
 	client := &http.Client{Timeout: httpTimeout}
-	var allLines []string
+	var proxies []*Proxy
+	skippedLines := 0
 	
-	for _, url := range proxySources {
-		fmt.Printf("Fetching from %s...\n", url)
-		resp, err := client.Get(url)
+	for _, source := range proxySources {
+		fmt.Printf("Fetching from %s...\n", source.URL)
+		resp, err := client.Get(source.URL)
 		if err != nil {
-			fmt.Printf("Failed to fetch from %s: %v\n", url, err)
-			output.Warn("Failed to fetch proxies from %s: %v", url, err)
+			fmt.Printf("Failed to fetch from %s: %v\n", source.URL, err)
+			output.Warn("Failed to fetch proxies from %s: %v", source.URL, err)
 			continue
 		}
 		
 		data, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
-			fmt.Printf("Failed to read from %s: %v\n", url, err)
-			output.Warn("Failed to read proxies from %s: %v", url, err)
+			fmt.Printf("Failed to read from %s: %v\n", source.URL, err)
+			output.Warn("Failed to read proxies from %s: %v", source.URL, err)
 			continue
 		}
 		
-		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
-		allLines = append(allLines, lines...)
-		fmt.Printf("Got %d lines from %s\n", len(lines), url)
+		lines := SplitLines(data)
+		parsed, skipped := ParseLines(lines, source.Type)
+		skippedLines += len(skipped)
+		proxies = append(proxies, parsed...)
+		fmt.Printf("Got %d %s proxies from %s\n", len(parsed), source.Type, source.URL)
 		
-		if len(allLines) >= maxProxies {
-			allLines = allLines[:maxProxies]
+		if len(proxies) >= maxProxies {
+			proxies = proxies[:maxProxies]
 			break
 		}
 	}
 	
-	proxies := parseProxies(allLines, SOCKS5)
+	if skippedLines > 0 {
+		output.Info("Skipped %d malformed lines from proxy sources", skippedLines)
+	}
 	
 	if len(proxies) == 0 {
 		return nil, false, fmt.Errorf("no proxies downloaded")
@@ -0,0 +1,364 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"daxwalkerfix/internal/bandwidth"
+)
+
+var schemes = map[string]ProxyType{
+	"socks5":     SOCKS5,
+	"socks5h":    SOCKS5,
+	"socks5+tls": SOCKS5,
+	"http":       HTTP,
+	"https":      HTTPS,
+	"socks4":     SOCKS4,
+	"socks4a":    SOCKS4A,
+}
+
+// The short "type:host:port" form predates TLS support, where "https:" meant
+// a plain CONNECT proxy, so it keeps that meaning here.
+var prefixes = map[string]ProxyType{
+	"socks5":     SOCKS5,
+	"socks5+tls": SOCKS5,
+	"http":       HTTP,
+	"https":      HTTP,
+	"socks4":     SOCKS4,
+	"socks4a":    SOCKS4A,
+}
+
+const chainSeparator = "->"
+
+var tlsOptions = map[string]bool{
+	"sni":      true,
+	"pin":      true,
+	"insecure": true,
+}
+
+type ParseError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v: %s", e.Line, e.Err, e.Text)
+}
+
+func SplitLines(data []byte) []string {
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	return strings.Split(text, "\n")
+}
+
+func ParseLines(lines []string, defaultType ProxyType) ([]*Proxy, []*ParseError) {
+	var proxies []*Proxy
+	var skipped []*ParseError
+	for n, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := ParseLine(line, defaultType)
+		if err != nil {
+			skipped = append(skipped, &ParseError{Line: n + 1, Text: line, Err: err})
+			continue
+		}
+		proxies = append(proxies, p)
+	}
+	return proxies, skipped
+}
+
+func ParseLine(line string, defaultType ProxyType) (*Proxy, error) {
+	segments := strings.Split(line, chainSeparator)
+	var hops []*Proxy
+	var options []string
+	for n, segment := range segments {
+		hop, rest, err := parseHop(segment, defaultType)
+		if err != nil {
+			if len(segments) > 1 {
+				return nil, fmt.Errorf("hop %d: %v", n+1, err)
+			}
+			return nil, err
+		}
+		hops = append(hops, hop)
+		options = append(options, rest...)
+	}
+
+	p := hops[len(hops)-1]
+	if len(hops) > 1 {
+		p.Chain = append([]*Proxy(nil), hops[:len(hops)-1]...)
+	}
+	if err := applyProxyOptions(p, options); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parseHop(line string, defaultType ProxyType) (*Proxy, []string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, nil, errors.New("empty proxy address")
+	}
+
+	p, err := parseAddress(fields[0], defaultType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rest []string
+	for _, option := range fields[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		key = strings.ToLower(key)
+		if !tlsOptions[key] {
+			rest = append(rest, option)
+			continue
+		}
+		if err := applyTLSOption(p, key, value); err != nil {
+			return nil, nil, err
+		}
+	}
+	return p, rest, nil
+}
+
+func parseAddress(line string, defaultType ProxyType) (*Proxy, error) {
+	if strings.Contains(line, "://") {
+		return parseURL(line)
+	}
+
+	proxyType := defaultType
+	useTLS := defaultType == HTTPS
+	if scheme, rest, ok := strings.Cut(line, ":"); ok {
+		if t, known := prefixes[strings.ToLower(scheme)]; known {
+			proxyType = t
+			useTLS = strings.HasSuffix(strings.ToLower(scheme), "+tls")
+			line = rest
+		}
+	}
+
+	var host, port string
+	var auth *url.Userinfo
+
+	if at := strings.LastIndex(line, "@"); at >= 0 {
+		auth = parseUserinfo(line[:at])
+		var err error
+		host, port, err = splitHostPort(line[at+1:])
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var extra []string
+		var err error
+		host, port, extra, err = splitColonFields(line)
+		if err != nil {
+			return nil, err
+		}
+		switch len(extra) {
+		case 0:
+		case 2:
+			auth = url.UserPassword(extra[0], extra[1])
+		default:
+			return nil, errors.New("expected host:port or host:port:user:pass")
+		}
+	}
+
+	return newProxy(proxyType, useTLS, host, port, auth)
+}
+
+func applyTLSOption(p *Proxy, key, value string) error {
+	if p.TLS == nil {
+		return fmt.Errorf("option %q needs an https:// or socks5+tls:// proxy", key)
+	}
+
+	switch key {
+	case "sni":
+		if value == "" {
+			return errors.New("sni needs a server name")
+		}
+		p.TLS.ServerName = value
+	case "pin":
+		pin, err := hex.DecodeString(strings.ReplaceAll(strings.TrimPrefix(value, "sha256:"), ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return errors.New("pin must be a hex SHA-256 certificate fingerprint")
+		}
+		p.TLS.Pin = pin
+	case "insecure":
+		p.TLS.SkipVerify = true
+	}
+	return nil
+}
+
+func applyProxyOptions(p *Proxy, options []string) error {
+	for _, option := range options {
+		key, value, _ := strings.Cut(option, "=")
+		switch strings.ToLower(key) {
+		case "weight":
+			weight, err := strconv.Atoi(value)
+			if err != nil || weight < 1 {
+				return fmt.Errorf("invalid weight %q", value)
+			}
+			p.Weight = weight
+		case "maxconns":
+			max, err := strconv.Atoi(value)
+			if err != nil || max < 1 {
+				return fmt.Errorf("invalid maxconns %q", value)
+			}
+			p.MaxConns = max
+		case "group":
+			if value == "" {
+				return fmt.Errorf("empty group name")
+			}
+			p.Group = strings.ToLower(value)
+		case "up", "down":
+			rate, err := bandwidth.ParseRate(value)
+			if err != nil {
+				return err
+			}
+			if strings.EqualFold(key, "up") {
+				p.UploadLimit = rate
+			} else {
+				p.DownloadLimit = rate
+			}
+		default:
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return nil
+}
+
+func HasExplicitType(line string) bool {
+	for _, segment := range strings.Split(line, chainSeparator) {
+		if !hasExplicitType(strings.TrimSpace(segment)) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasExplicitType(line string) bool {
+	if scheme, _, ok := strings.Cut(line, "://"); ok {
+		_, known := schemes[strings.ToLower(scheme)]
+		return known
+	}
+	scheme, _, ok := strings.Cut(line, ":")
+	if !ok {
+		return false
+	}
+	_, known := prefixes[strings.ToLower(scheme)]
+	return known
+}
+
+func parseURL(line string) (*Proxy, error) {
+	u, err := url.Parse(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	proxyType, ok := schemes[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("unexpected path %q", u.Path)
+	}
+	if u.Port() == "" {
+		return nil, errors.New("missing port")
+	}
+
+	var auth *url.Userinfo
+	if u.User != nil && u.User.Username() != "" {
+		auth = u.User
+	}
+
+	useTLS := proxyType == HTTPS || strings.HasSuffix(scheme, "+tls")
+	return newProxy(proxyType, useTLS, u.Hostname(), u.Port(), auth)
+}
+
+func parseUserinfo(s string) *url.Userinfo {
+	user, pass, ok := strings.Cut(s, ":")
+	if !ok {
+		return url.User(user)
+	}
+	return url.UserPassword(user, pass)
+}
+
+func splitHostPort(s string) (string, string, error) {
+	host, port, extra, err := splitColonFields(s)
+	if err != nil {
+		return "", "", err
+	}
+	if len(extra) > 0 {
+		return "", "", errors.New("unexpected data after port")
+	}
+	return host, port, nil
+}
+
+func splitColonFields(s string) (string, string, []string, error) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return "", "", nil, errors.New("missing ] in IPv6 address")
+		}
+		host := s[1:end]
+		rest, ok := strings.CutPrefix(s[end+1:], ":")
+		if !ok {
+			return "", "", nil, errors.New("missing port")
+		}
+		fields := strings.SplitN(rest, ":", 3)
+		return host, fields[0], fields[1:], nil
+	}
+
+	fields := strings.SplitN(s, ":", 4)
+	if len(fields) < 2 {
+		return "", "", nil, errors.New("missing port")
+	}
+	if _, err := parsePort(fields[1]); err != nil && looksLikeIPv6(s) {
+		return "", "", nil, errors.New("IPv6 address must be in brackets, e.g. [::1]:1080")
+	}
+	return fields[0], fields[1], fields[2:], nil
+}
+
+func looksLikeIPv6(s string) bool {
+	return strings.Contains(s, "::") || strings.Count(s, ":") > 4
+}
+
+func parsePort(port string) (int, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("invalid port %q", port)
+	}
+	return n, nil
+}
+
+func newProxy(proxyType ProxyType, useTLS bool, host, port string, auth *url.Userinfo) (*Proxy, error) {
+	if host == "" {
+		return nil, errors.New("missing host")
+	}
+	if strings.ContainsAny(host, " \t/@[]") {
+		return nil, fmt.Errorf("invalid host %q", host)
+	}
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("invalid IPv6 address %q", host)
+	}
+	if _, err := parsePort(port); err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		Address: net.JoinHostPort(host, port),
+		Auth:    auth,
+		Type:    proxyType,
+	}
+	if useTLS {
+		p.TLS = &TLSOptions{}
+	}
+	return p, nil
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type ProxyType int
+
+const (
+	SOCKS5 ProxyType = iota
+	HTTP
+	SOCKS4
+	SOCKS4A
+	HTTPS
+)
+
+type Proxy struct {
+	Address string
+	Auth    *url.Userinfo
+	Type    ProxyType
+	TLS     *TLSOptions
+	Chain   []*Proxy
+	Weight  int
+	Group   string
+
+	MaxConns      int
+	UploadLimit   int64
+	DownloadLimit int64
+}
+
+type TLSOptions struct {
+	ServerName string
+	Pin        []byte
+	SkipVerify bool
+}
+
+func (t ProxyType) String() string {
+	switch t {
+	case SOCKS5:
+		return "SOCKS5"
+	case HTTP:
+		return "HTTP"
+	case SOCKS4:
+		return "SOCKS4"
+	case SOCKS4A:
+		return "SOCKS4a"
+	case HTTPS:
+		return "HTTPS"
+	default:
+		return "unknown"
+	}
+}
+
+func (t ProxyType) Scheme() string {
+	return strings.ToLower(t.String())
+}
+
+func (p *Proxy) Scheme() string {
+	if p.TLS != nil && p.Type != HTTPS {
+		return p.Type.Scheme() + "+tls"
+	}
+	return p.Type.Scheme()
+}
+
+func (p *Proxy) EffectiveWeight() int {
+	if p.Weight <= 0 {
+		return 1
+	}
+	return p.Weight
+}
+
+func (p *Proxy) Hops() []*Proxy {
+	return append(append([]*Proxy{}, p.Chain...), p)
+}
+
+func (p *Proxy) String() string {
+	return p.join(func(hop *Proxy) string {
+		return hop.Scheme() + "://" + hop.Address
+	})
+}
+
+func (p *Proxy) Label() string {
+	return p.join(func(hop *Proxy) string {
+		return hop.Type.String() + " " + hop.Address
+	})
+}
+
+func (p *Proxy) URL() string {
+	return p.url(true)
+}
+
+func (p *Proxy) RedactedURL() string {
+	return p.url(false)
+}
+
+func (p *Proxy) url(withAuth bool) string {
+	s := p.join(func(hop *Proxy) string {
+		return hop.hopURL(withAuth)
+	})
+	if p.Weight > 0 {
+		s += " weight=" + strconv.Itoa(p.Weight)
+	}
+	if p.Group != "" {
+		s += " group=" + p.Group
+	}
+	if p.MaxConns > 0 {
+		s += " maxconns=" + strconv.Itoa(p.MaxConns)
+	}
+	if p.UploadLimit > 0 {
+		s += " up=" + strconv.FormatInt(p.UploadLimit, 10)
+	}
+	if p.DownloadLimit > 0 {
+		s += " down=" + strconv.FormatInt(p.DownloadLimit, 10)
+	}
+	return s
+}
+
+func (p *Proxy) join(format func(*Proxy) string) string {
+	var parts []string
+	for _, hop := range p.Hops() {
+		parts = append(parts, format(hop))
+	}
+	return strings.Join(parts, " -> ")
+}
+
+func (p *Proxy) hopURL(withAuth bool) string {
+	s := p.Scheme() + "://"
+	if withAuth && p.Auth != nil {
+		s += p.Auth.String() + "@"
+	}
+	s += p.Address
+	if p.TLS != nil {
+		if p.TLS.ServerName != "" {
+			s += " sni=" + p.TLS.ServerName
+		}
+		if p.TLS.Pin != nil {
+			s += " pin=" + hex.EncodeToString(p.TLS.Pin)
+		}
+		if p.TLS.SkipVerify {
+			s += " insecure"
+		}
+	}
+	return s
+}
@@ -0,0 +1,283 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	queryTimeout = 3 * time.Second
+	maxCacheTTL  = 10 * time.Minute
+)
+
+var DefaultServers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
+var errNoAnswer = errors.New("no address in DNS answer")
+
+type Resolver struct {
+	servers []string
+
+	mu     sync.Mutex
+	pinned map[string][]net.IP
+	cache  map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+func New(servers []string) *Resolver {
+	if len(servers) == 0 {
+		servers = DefaultServers
+	}
+	return &Resolver{
+		servers: servers,
+		pinned:  make(map[string][]net.IP),
+		cache:   make(map[string]cacheEntry),
+	}
+}
+
+func ParseServers(list string) ([]string, error) {
+	var servers []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(item)
+		if err != nil {
+			host, port = strings.Trim(item, "[]"), "53"
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("DNS server %q must be an IP address", item)
+		}
+		servers = append(servers, net.JoinHostPort(host, port))
+	}
+	return servers, nil
+}
+
+func ParsePins(list string) (map[string][]net.IP, error) {
+	pins := make(map[string][]net.IP)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, addr, ok := strings.Cut(item, "=")
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		if !ok || ip == nil {
+			return nil, fmt.Errorf("invalid pin %q, expected name=ip", item)
+		}
+		name = normalize(name)
+		pins[name] = append(pins[name], ip)
+	}
+	return pins, nil
+}
+
+func (r *Resolver) Pin(name string, ips []net.IP) {
+	r.mu.Lock()
+	r.pinned[normalize(name)] = ips
+	r.mu.Unlock()
+}
+
+func (r *Resolver) Servers() []string {
+	return append([]string(nil), r.servers...)
+}
+
+func (r *Resolver) LookupIP(ctx context.Context, name string) ([]net.IP, error) {
+	if ip := net.ParseIP(strings.Trim(name, "[]")); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	name = normalize(name)
+
+	r.mu.Lock()
+	if ips, ok := r.pinned[name]; ok {
+		r.mu.Unlock()
+		return ips, nil
+	}
+	if entry, ok := r.cache[name]; ok && time.Now().Before(entry.expires) {
+		r.mu.Unlock()
+		return entry.ips, nil
+	}
+	r.mu.Unlock()
+
+	var lastErr error
+	for _, server := range r.servers {
+		ips, ttl, err := r.lookup(ctx, server, name)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if ttl > 0 {
+			r.mu.Lock()
+			r.cache[name] = cacheEntry{ips: ips, expires: time.Now().Add(min(ttl, maxCacheTTL))}
+			r.mu.Unlock()
+		}
+		return ips, nil
+	}
+	return nil, fmt.Errorf("failed to resolve %s: %v", name, lastErr)
+}
+
+func (r *Resolver) LookupIPv4(ctx context.Context, name string) (net.IP, error) {
+	ips, err := r.LookupIP(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+	}
+	return nil, fmt.Errorf("no IPv4 address for %s", name)
+}
+
+func (r *Resolver) lookup(ctx context.Context, server, name string) ([]net.IP, time.Duration, error) {
+	ips, ttl, err := query(ctx, server, name, dnsmessage.TypeA)
+	if errors.Is(err, errNoAnswer) {
+		ips, ttl, err = query(ctx, server, name, dnsmessage.TypeAAAA)
+	}
+	return ips, ttl, err
+}
+
+func query(ctx context.Context, server, name string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid name %q", name)
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	req, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := exchange(ctx, "udp", server, req)
+	if err == nil && resp.Truncated {
+		resp, err = exchange(ctx, "tcp", server, req)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.ID != id || !resp.Response {
+		return nil, 0, fmt.Errorf("mismatched DNS response from %s", server)
+	}
+	if resp.RCode == dnsmessage.RCodeNameError {
+		return nil, 0, fmt.Errorf("no such host")
+	}
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("DNS server %s returned %v", server, resp.RCode)
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	for _, answer := range resp.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		default:
+			continue
+		}
+		if ttl == 0 || answer.Header.TTL < ttl {
+			ttl = answer.Header.TTL
+		}
+	}
+	if len(ips) == 0 {
+		return nil, 0, errNoAnswer
+	}
+	return ips, time.Duration(ttl) * time.Second, nil
+}
+
+func (r *Resolver) Exchange(ctx context.Context, network string, req []byte) ([]byte, error) {
+	var lastErr error
+	for _, server := range r.servers {
+		resp, err := exchangeRaw(ctx, network, server, req)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func exchange(ctx context.Context, network, server string, req []byte) (*dnsmessage.Message, error) {
+	buf, err := exchangeRaw(ctx, network, server, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, fmt.Errorf("bad DNS response from %s: %v", server, err)
+	}
+	return &resp, nil
+}
+
+func exchangeRaw(ctx context.Context, network, server string, req []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	var buf []byte
+	if network == "tcp" {
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(req)))
+		if _, err := conn.Write(append(framed, req...)); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	}
+	return buf, nil
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}